@@ -0,0 +1,239 @@
+// Package census keeps track of the transmitters heard, also those the
+// receiver does not listen for, to find out which IDs are in use nearby.
+//
+// The packets of a transmitter which is not listened for are only caught
+// while the receiver happens to be on the same channel, so the time between
+// two of them is usually several hop periods. The period is estimated from
+// those times where they fit a whole number of the period its ID should
+// have, within the drift of a transmitter's clock and the jitter of the
+// arrival times.
+package census
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	arrivalJitter = 20 * time.Millisecond // of the arrival time of a packet
+	clockDrift    = 100e-6                // of a transmitter's clock
+	// ownIntervals is how many intervals in a row must fit the period of
+	// an ID for Own.
+	ownIntervals = 2
+)
+
+// Period returns the nominal hop period of a transmitter with id 0-7.
+func Period(id int) time.Duration {
+	return 2562500*time.Microsecond + time.Duration(id)*62500*time.Microsecond
+}
+
+// Entry is what was heard of one ID.
+type Entry struct {
+	ID          int
+	Defined     bool // listened for
+	Packets     int
+	First, Last time.Time
+	Channels    map[int]int    // packets per channel
+	Kinds       map[string]int // packets per decoded sensor type
+	Repeaters   map[int]int    // packets per repeater, 0 directly
+
+	rssiSum, rssiMax float64
+	rssiN            int
+	freqErrSum       int
+	periodSum        float64 // ns
+	periodN          int
+	run, longestRun  int // of intervals fitting the period
+}
+
+// RSSI returns the mean signal strength in dBFS, -Inf without a value.
+func (e *Entry) RSSI() float64 {
+	if e.rssiN == 0 {
+		return math.Inf(-1)
+	}
+	return e.rssiSum / float64(e.rssiN)
+}
+
+// FreqError returns the mean frequency error in Hz.
+func (e *Entry) FreqError() int {
+	if e.Packets == 0 {
+		return 0
+	}
+	return e.freqErrSum / e.Packets
+}
+
+// Period returns the estimated hop period, 0 while it is not known.
+func (e *Entry) Period() time.Duration {
+	if e.periodN == 0 {
+		return 0
+	}
+	return time.Duration(e.periodSum / float64(e.periodN))
+}
+
+// Census is what was heard of all IDs.
+type Census struct {
+	entries [8]*Entry
+}
+
+// New returns an empty census.
+func New() *Census {
+	return new(Census)
+}
+
+// Packet is a received packet as the census sees it.
+type Packet struct {
+	Time      time.Time
+	ID        int
+	Defined   bool
+	Channel   int
+	RSSI      float64 // dBFS
+	FreqError int     // Hz
+	Kind      string  // decoded sensor type
+	Repeater  int
+}
+
+// Add counts a packet.
+func (c *Census) Add(p Packet) {
+	e := c.entries[p.ID]
+	if e == nil {
+		e = &Entry{
+			ID:        p.ID,
+			First:     p.Time,
+			Channels:  make(map[int]int),
+			Kinds:     make(map[string]int),
+			Repeaters: make(map[int]int),
+			rssiMax:   math.Inf(-1),
+		}
+		c.entries[p.ID] = e
+	} else if d := p.Time.Sub(e.Last); d > 0 {
+		// a whole number of periods; a copy of the packet through a
+		// repeater is no interval at all
+		nominal := float64(Period(p.ID))
+		n := math.Floor(float64(d)/nominal + 0.5)
+		switch {
+		case n < 1:
+		case math.Abs(float64(d)-n*nominal) <= float64(arrivalJitter)+n*nominal*clockDrift:
+			e.periodSum += float64(d) / n
+			e.periodN++
+			e.run++
+			if e.run > e.longestRun {
+				e.longestRun = e.run
+			}
+		default:
+			e.run = 0
+		}
+	}
+	e.Defined = p.Defined
+	e.Packets++
+	e.Last = p.Time
+	e.Channels[p.Channel]++
+	if p.Kind != "" {
+		e.Kinds[p.Kind]++
+	}
+	e.Repeaters[p.Repeater]++
+	if !math.IsInf(p.RSSI, 0) && !math.IsNaN(p.RSSI) {
+		e.rssiSum += p.RSSI
+		e.rssiN++
+		e.rssiMax = math.Max(e.rssiMax, p.RSSI)
+	}
+	e.freqErrSum += p.FreqError
+}
+
+// Entries returns the IDs heard, in order.
+func (c *Census) Entries() (entries []*Entry) {
+	for _, e := range c.entries {
+		if e != nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// timely tells whether the estimated period of e is the period of its ID,
+// within the drift of a transmitter's clock.
+func (e *Entry) timely() bool {
+	p := e.Period()
+	return p != 0 && math.Abs(float64(p-Period(e.ID))) <= float64(Period(e.ID))/200
+}
+
+// steady tells whether e was heard ownIntervals times in a row at a whole
+// number of the periods of its ID.
+func (e *Entry) steady() bool {
+	return e.longestRun >= ownIntervals && e.timely()
+}
+
+// Own returns the IDs which are likely those of the receiver's own
+// transmitters: heard with the hop period of their ID ownIntervals times in
+// a row, and at most margin dB weaker than the strongest of them. A
+// transmitter much weaker than the strongest one is a neighbour's.
+func (c *Census) Own(margin float64) (ids []int) {
+	strongest := math.Inf(-1)
+	for _, e := range c.Entries() {
+		if e.steady() {
+			strongest = math.Max(strongest, e.RSSI())
+		}
+	}
+	for _, e := range c.Entries() {
+		if e.steady() && e.RSSI() >= strongest-margin {
+			ids = append(ids, e.ID)
+		}
+	}
+	return ids
+}
+
+// WriteTable writes the census as a table, one line per ID heard. The
+// Davis ID is the ID + 1, as on a console.
+func (c *Census) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDavis ID\tdefined\tpackets\tlast\tperiod\tchannels\trssi\tmax rssi\tfreq err\tvia\tsensors")
+	for _, e := range c.Entries() {
+		defined := "no"
+		if e.Defined {
+			defined = "yes"
+		}
+		period := "-"
+		if p := e.Period(); p != 0 {
+			period = fmt.Sprintf("%.4fs", p.Seconds())
+			if !e.timely() {
+				period += "?" // not the period of its ID
+			}
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%d\t%s\t%s\t%d\t%.1f\t%.1f\t%d\t%s\t%s\n",
+			e.ID, e.ID+1, defined, e.Packets, e.Last.Format("15:04:05"), period, len(e.Channels),
+			e.RSSI(), e.rssiMax, e.FreqError(), repeaters(e.Repeaters), kinds(e.Kinds))
+	}
+	return tw.Flush()
+}
+
+// repeaters lists the repeaters by letter, - for packets received directly.
+func repeaters(m map[int]int) string {
+	var names []string
+	for r := range m {
+		if r == 0 {
+			names = append(names, "-")
+		} else {
+			names = append(names, string(rune('A'+r-1)))
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// kinds lists the sensor types, most frequent first.
+func kinds(m map[string]int) string {
+	var names []string
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if m[names[i]] != m[names[j]] {
+			return m[names[i]] > m[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,83 @@
+package census
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCensus(t *testing.T) {
+	c := New()
+	start := time.Date(2019, 3, 24, 12, 0, 0, 0, time.UTC)
+	// a neighbour's ISS on ID 2, running a bit slow, caught every few hops
+	period := Period(2) + 300*time.Microsecond
+	for i, hops := range []int{0, 3, 7, 8, 20, 21} {
+		c.Add(Packet{
+			Time:      start.Add(time.Duration(hops) * period),
+			ID:        2,
+			Channel:   i % 3,
+			RSSI:      -30 - float64(i),
+			FreqError: -1000,
+			Kind:      []string{"temperature", "humidity"}[i%2],
+		})
+	}
+	// our ISS
+	c.Add(Packet{Time: start, ID: 0, Defined: true, RSSI: -20, Kind: "temperature"})
+	c.Add(Packet{Time: start.Add(4 * time.Second), ID: 0, Defined: true, RSSI: -20, Kind: "temperature"})
+
+	entries := c.Entries()
+	if len(entries) != 2 || entries[0].ID != 0 || entries[1].ID != 2 {
+		t.Fatalf("got %v", entries)
+	}
+	e := entries[1]
+	if e.Packets != 6 || len(e.Channels) != 3 || e.Defined || e.FreqError() != -1000 || e.RSSI() != -32.5 {
+		t.Errorf("got %+v", e)
+	}
+	if d := e.Period() - period; d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("period %s, want %s", e.Period(), period)
+	}
+	// 4 s is not a whole number of periods
+	if p := entries[0].Period(); p != 0 {
+		t.Errorf("ID 0 period %s, want unknown", p)
+	}
+
+	var buf bytes.Buffer
+	if err := c.WriteTable(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got\n%s", buf.String())
+	}
+	for _, want := range []string{"2", "3", "no", "6", "humidity,temperature", "-30.0"} {
+		if !strings.Contains(lines[2], want) {
+			t.Errorf("%q not in %q", want, lines[2])
+		}
+	}
+	if !strings.Contains(lines[2], "2.6878s") {
+		t.Errorf("period not in %q", lines[2])
+	}
+}
+
+func TestOwn(t *testing.T) {
+	c := New()
+	start := time.Date(2019, 3, 24, 12, 0, 0, 0, time.UTC)
+	add := func(id, hops int, rssi float64, period time.Duration) {
+		c.Add(Packet{Time: start.Add(time.Duration(hops) * period), ID: id, RSSI: rssi})
+	}
+	for _, hops := range []int{0, 51, 77} {
+		add(0, hops, -20, Period(0))                  // ours
+		add(2, hops, -28, Period(2))                  // ours, further away
+		add(3, hops, -55, Period(3))                  // the neighbour's
+		add(5, hops, -20, Period(2))                  // something else on ID 5
+		add(4, hops, -20, Period(4)+time.Millisecond) // a clock far off
+	}
+	add(6, 0, -15, Period(6)) // heard once
+	add(7, 0, -15, Period(7)) // heard twice
+	add(7, 51, -15, Period(7))
+	ids := c.Own(20)
+	if len(ids) != 2 || ids[0] != 0 || ids[1] != 2 {
+		t.Errorf("got %v, want [0 2]", ids)
+	}
+}
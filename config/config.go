@@ -0,0 +1,246 @@
+// Package config reads the rtldavis configuration file.
+//
+// The file uses a small subset of TOML: top-level "key = value" pairs named
+// after the command-line flags, followed by one [[transmitter]] table per
+// transmitter:
+//
+//	tf = "US"
+//	maxmissed = 4
+//
+//	[[transmitter]]
+//	id = 0
+//	name = "ISS"
+//	type = "iss"
+//
+//	[[transmitter]]
+//	id = 1
+//	name = "Mast"
+//	type = "anemometer"
+//	wind_offset = -15
+//
+//	[[transmitter]]
+//	id = 2
+//	name = "Garden"
+//	type = "temphum"
+//	freq_offset = -1500
+//	priority = 1
+//
+// Values are strings (double or single quoted), integers, floats and
+// booleans. Comments start with '#'.
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Station types of a transmitter.
+const (
+	TypeAuto       = "auto"       // Vantage Pro2 or Vue ISS, detected from its packets
+	TypeISS        = "iss"        // Vantage Pro2 ISS
+	TypeVue        = "vue"        // Vantage Vue ISS
+	TypeTempHum    = "temphum"    // temperature/humidity station (6372/6382)
+	TypeLeafSoil   = "leafsoil"   // leaf & soil moisture station (6345)
+	TypeAnemometer = "anemometer" // anemometer transmitter kit (6332)
+)
+
+var stationTypes = []string{TypeAuto, TypeISS, TypeVue, TypeTempHum, TypeLeafSoil, TypeAnemometer}
+
+// Transmitter is the configuration of one transmitter.
+type Transmitter struct {
+	ID         int    // transmitter ID 0-7 (Davis ID 1-8)
+	Name       string // friendly name used in the output
+	Type       string // station type, one of the Type constants
+	FreqOffset int    // frequency offset in Hz added to all channels
+	Priority   int    // priority in a collision with another transmitter; 0 = by type
+	WindOffset int    // degrees added to the wind direction, e.g. for a vane not aligned to north
+	Repeater   int    // repeater 1-8 (A-H) the transmitter is received through; 0 = directly
+}
+
+// Config is the content of a configuration file.
+type Config struct {
+	// Settings holds the top-level values by flag name, strings unquoted.
+	Settings     map[string]string
+	Transmitters []Transmitter
+}
+
+// Load reads and parses the configuration file at path.
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse parses a configuration from r.
+func Parse(r io.Reader) (*Config, error) {
+	cfg := &Config{Settings: make(map[string]string)}
+	var tr *Transmitter
+	seen := make(map[int]bool)
+
+	scanner := bufio.NewScanner(r)
+	for lineNr := 1; scanner.Scan(); lineNr++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if line != "[[transmitter]]" {
+				return nil, fmt.Errorf("line %d: unknown table %s", lineNr, line)
+			}
+			if err := check(tr, seen); err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNr, err)
+			}
+			cfg.Transmitters = append(cfg.Transmitters, Transmitter{ID: -1, Type: TypeAuto})
+			tr = &cfg.Transmitters[len(cfg.Transmitters)-1]
+			continue
+		}
+
+		key, value, err := parseKeyValue(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNr, err)
+		}
+		if tr == nil {
+			if _, dup := cfg.Settings[key]; dup {
+				return nil, fmt.Errorf("line %d: duplicate key %s", lineNr, key)
+			}
+			cfg.Settings[key] = value
+			continue
+		}
+		if err := tr.set(key, value); err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNr, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := check(tr, seen); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Mask returns the -tr bitmask of the configured transmitters.
+func (c *Config) Mask() (mask int) {
+	for _, tr := range c.Transmitters {
+		mask |= 1 << uint(tr.ID)
+	}
+	return mask
+}
+
+func (tr *Transmitter) set(key, value string) (err error) {
+	switch key {
+	case "id":
+		tr.ID, err = strconv.Atoi(value)
+		if err == nil && (tr.ID < 0 || tr.ID > 7) {
+			err = fmt.Errorf("id %d out of range 0-7", tr.ID)
+		}
+	case "name":
+		tr.Name = value
+	case "type":
+		tr.Type = strings.ToLower(value)
+		for _, t := range stationTypes {
+			if tr.Type == t {
+				return nil
+			}
+		}
+		err = fmt.Errorf("unknown transmitter type %q, expected one of %s", value, strings.Join(stationTypes, ", "))
+	case "freq_offset":
+		tr.FreqOffset, err = strconv.Atoi(value)
+	case "priority":
+		tr.Priority, err = strconv.Atoi(value)
+	case "repeater":
+		if r := strings.ToUpper(value); len(r) == 1 && r[0] >= 'A' && r[0] <= 'H' {
+			tr.Repeater = int(r[0]-'A') + 1
+		} else {
+			err = fmt.Errorf("unknown repeater %q, expected A-H", value)
+		}
+	case "wind_offset":
+		tr.WindOffset, err = strconv.Atoi(value)
+		if err == nil && (tr.WindOffset <= -360 || tr.WindOffset >= 360) {
+			err = fmt.Errorf("wind_offset %d out of range -359-359", tr.WindOffset)
+		}
+	default:
+		err = fmt.Errorf("unknown transmitter key %s", key)
+	}
+	return err
+}
+
+// check validates a completed [[transmitter]] table.
+func check(tr *Transmitter, seen map[int]bool) error {
+	if tr == nil {
+		return nil
+	}
+	if tr.ID < 0 {
+		return fmt.Errorf("transmitter %q without id", tr.Name)
+	}
+	if seen[tr.ID] {
+		return fmt.Errorf("transmitter id %d configured twice", tr.ID)
+	}
+	seen[tr.ID] = true
+	return nil
+}
+
+// parseKeyValue splits "key = value" and unquotes string values.
+func parseKeyValue(line string) (key, value string, err error) {
+	eq := strings.Index(line, "=")
+	if eq < 0 {
+		return "", "", fmt.Errorf("expected key = value, got %q", line)
+	}
+	key = strings.TrimSpace(line[:eq])
+	value = strings.TrimSpace(line[eq+1:])
+	if key == "" || strings.IndexFunc(key, func(r rune) bool {
+		return !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) >= 0 {
+		return "", "", fmt.Errorf("invalid key %q", key)
+	}
+	if value == "" {
+		return "", "", fmt.Errorf("missing value for %s", key)
+	}
+
+	switch value[0] {
+	case '"':
+		value, err = strconv.Unquote(value)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid string for %s: %s", key, err)
+		}
+	case '\'':
+		if len(value) < 2 || value[len(value)-1] != '\'' {
+			return "", "", fmt.Errorf("unterminated string for %s", key)
+		}
+		value = value[1 : len(value)-1]
+	default:
+		value = strings.Replace(value, "_", "", -1) // 1_000 is a valid TOML integer
+	}
+	return key, value, nil
+}
+
+// stripComment removes a '#' comment which is not inside a string.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
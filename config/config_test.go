@@ -0,0 +1,94 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const example = `
+# receiver
+tf = "US"          # US frequencies
+maxmissed = 4
+gain = 1_440
+noafc = false
+state = '/var/lib/rtldavis/state#1'
+
+[[transmitter]]
+id = 0
+name = "ISS \"roof\""
+
+[[transmitter]]
+id = 2
+name = "Garden"
+type = "TempHum"
+freq_offset = -1500
+priority = 3
+
+[[transmitter]]
+id = 3
+type = "anemometer"
+wind_offset = -15
+repeater = "b"
+`
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(example))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := map[string]string{
+		"tf":        "US",
+		"maxmissed": "4",
+		"gain":      "1440",
+		"noafc":     "false",
+		"state":     "/var/lib/rtldavis/state#1",
+	}
+	if len(cfg.Settings) != len(settings) {
+		t.Errorf("got %d settings, want %d: %v", len(cfg.Settings), len(settings), cfg.Settings)
+	}
+	for k, v := range settings {
+		if cfg.Settings[k] != v {
+			t.Errorf("%s: got %q, want %q", k, cfg.Settings[k], v)
+		}
+	}
+
+	want := []Transmitter{
+		{ID: 0, Name: `ISS "roof"`, Type: TypeAuto},
+		{ID: 2, Name: "Garden", Type: TypeTempHum, FreqOffset: -1500, Priority: 3},
+		{ID: 3, Type: TypeAnemometer, WindOffset: -15, Repeater: 2},
+	}
+	if len(cfg.Transmitters) != len(want) {
+		t.Fatalf("got %d transmitters, want %d", len(cfg.Transmitters), len(want))
+	}
+	for i, tr := range want {
+		if cfg.Transmitters[i] != tr {
+			t.Errorf("transmitter %d: got %+v, want %+v", i, cfg.Transmitters[i], tr)
+		}
+	}
+	if mask := cfg.Mask(); mask != 13 {
+		t.Errorf("Mask: got %d, want 13", mask)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{
+		"tr",
+		"tr = ",
+		"bad key = 1",
+		"name = \"unterminated",
+		"tr = 1\ntr = 2",
+		"[station]",
+		"[[transmitter]]\nname = \"no id\"",
+		"[[transmitter]]\nid = 8",
+		"[[transmitter]]\nid = 1\ntype = \"weird\"",
+		"[[transmitter]]\nid = 1\ncolour = \"red\"",
+		"[[transmitter]]\nid = 1\nwind_offset = 360",
+		"[[transmitter]]\nid = 1\nrepeater = \"I\"",
+		"[[transmitter]]\nid = 1\n[[transmitter]]\nid = 1",
+	} {
+		if _, err := Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+
+	"config"
+	"protocol"
+)
+
+var (
+	cmdlineFlags map[string]bool       // flags set on the command line
+	trConfig     [8]config.Transmitter // per id transmitter configuration
+)
+
+// loadConfig applies the configuration file at startup. Settings are applied
+// as if given as flags, except for flags also given on the command line.
+func loadConfig(path string) error {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	cmdlineFlags = make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		cmdlineFlags[f.Name] = true
+	})
+	for name, value := range cfg.Settings {
+		if name == "config" || flag.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown setting %s", path, name)
+		}
+		if cmdlineFlags[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %s: %s", path, name, err)
+		}
+	}
+	if _, ok := cfg.Settings["tr"]; !ok && !cmdlineFlags["tr"] && len(cfg.Transmitters) > 0 {
+		tr = cfg.Mask()
+	}
+	setTransmitterConfig(cfg)
+	return nil
+}
+
+// reloadConfig is called on SIGHUP. It re-reads the configuration file and
+// returns the runtime settings it asks for and the configuration, whose
+// transmitters are applied with setTransmitterConfig once the settings are.
+// Other settings only take effect after a restart.
+func reloadConfig(p *protocol.Parser) (s settings, cfg *config.Config, ok bool) {
+	if *stateFile != "" {
+		if err := saveState(*stateFile, p); err != nil {
+			log.Printf("State %s not saved: %s", *stateFile, err)
+		}
+	}
+	if *configFile == "" {
+		log.Printf("SIGHUP: no configuration file to reload")
+		return s, nil, false
+	}
+	log.Printf("SIGHUP: reload configuration %s", *configFile)
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Printf("Configuration not reloaded: %s", err)
+		return s, nil, false
+	}
+
+	s = currentSettings()
+	runtime := map[string]*int{
+		"tr":        &s.Tr,
+		"fc":        &s.Fc,
+		"ppm":       &s.Ppm,
+		"gain":      &s.Gain,
+		"maxmissed": &s.MaxMissed,
+	}
+	for name, value := range cfg.Settings {
+		if cmdlineFlags[name] {
+			continue
+		}
+		if name == "tr" && value == "auto" {
+			continue // keep the transmitters detected at startup
+		}
+		if v, ok := runtime[name]; ok {
+			if *v, err = strconv.Atoi(value); err != nil {
+				log.Printf("Configuration not reloaded: %s: %s", name, err)
+				return s, nil, false
+			}
+		} else if f := flag.Lookup(name); f != nil && f.Value.String() != value {
+			log.Printf("Configuration: %s=%s takes effect after a restart", name, value)
+		}
+	}
+	if _, ok := cfg.Settings["tr"]; !ok && !cmdlineFlags["tr"] && len(cfg.Transmitters) > 0 {
+		s.Tr = cfg.Mask()
+	}
+	return s, cfg, true
+}
+
+// setTransmitterConfig stores the per transmitter configuration; transmitters
+// without a [[transmitter]] table get the defaults.
+func setTransmitterConfig(cfg *config.Config) {
+	for id := range trConfig {
+		trConfig[id] = config.Transmitter{ID: id, Type: config.TypeAuto}
+	}
+	for _, t := range cfg.Transmitters {
+		trConfig[t.ID] = t
+	}
+	for id := range trConfig {
+		idTrackers[id].SetRelayed(trConfig[id].Repeater != 0)
+	}
+}
+
+// withOffset returns h with the offset to tune to: -fc and the frequency
+// offset of the expected transmitter. The hop goroutine gets them with the
+// hop, as the main loop may change them at any time.
+func withOffset(h protocol.Hop) protocol.Hop {
+	h.Offset = fc
+	if h.ExpectedTr >= 0 {
+		h.Offset += trConfig[h.ExpectedTr].FreqOffset
+	}
+	return h
+}
+
+// trName returns the name of a transmitter for the output.
+func trName(id int) string {
+	if trConfig[id].Name != "" {
+		return trConfig[id].Name
+	}
+	return fmt.Sprintf("ID %d", id)
+}
+
+// trType returns the station type of a transmitter. The model of an ISS of
+// type auto is the one detected from its packets so far; it stays auto
+// until it is known.
+func trType(id int) string {
+	if trConfig[id].Type != config.TypeAuto {
+		return trConfig[id].Type
+	}
+	if m := idModels[id].Model(); m != "" {
+		return m
+	}
+	return config.TypeAuto
+}
+
+// trPriority returns the priority of a transmitter when its packets collide
+// with those of another one: the configured one, or by default an ISS
+// before the other station types.
+func trPriority(id int) int {
+	if trConfig[id].Priority != 0 {
+		return trConfig[id].Priority
+	}
+	switch trConfig[id].Type {
+	case config.TypeAuto, config.TypeISS, config.TypeVue:
+		return 2
+	}
+	return 1
+}
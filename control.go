@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/jpoirier/gortlsdr"
+)
+
+// settings are the program settings which can be changed while running.
+type settings struct {
+	Tr        int `json:"tr"`
+	Fc        int `json:"fc"`
+	Ppm       int `json:"ppm"`
+	Gain      int `json:"gain"`
+	MaxMissed int `json:"maxmissed"`
+}
+
+func (s settings) String() string {
+	return fmt.Sprintf("tr=%d fc=%d ppm=%d gain=%d maxmissed=%d", s.Tr, s.Fc, s.Ppm, s.Gain, s.MaxMissed)
+}
+
+func (s settings) validate() error {
+	if s.Tr < 1 || s.Tr > 255 {
+		return fmt.Errorf("tr=%d: must be 1..255", s.Tr)
+	}
+	if s.Gain < 0 {
+		return fmt.Errorf("gain=%d: must not be negative", s.Gain)
+	}
+	if s.MaxMissed < 0 {
+		return fmt.Errorf("maxmissed=%d: must not be negative", s.MaxMissed)
+	}
+	return nil
+}
+
+func currentSettings() settings {
+	return settings{Tr: tr, Fc: fc, Ppm: ppm, Gain: gain, MaxMissed: maxmissed}
+}
+
+// reconfRequest asks the main loop for the current settings or, with apply
+// set, to apply new ones. The main loop answers on reply.
+type reconfRequest struct {
+	apply    bool
+	settings settings
+	reply    chan reconfReply
+}
+
+type reconfReply struct {
+	current settings
+	err     error
+}
+
+// applySettings re-applies changed settings at runtime. Tuner settings are
+// handed to tunerDo so they are applied by the goroutine owning the device,
+// and applied first: when one fails nothing else changes, and a ppm already
+// applied is set back. trChanged reports whether the set of transmitters
+// changed and the hop schedule has to be recalculated.
+func applySettings(s settings, tunerDo func(func(*rtlsdr.Context) error) error) (trChanged bool, err error) {
+	if err := s.validate(); err != nil {
+		return false, err
+	}
+	old := currentSettings()
+	if s == old {
+		return false, nil
+	}
+	log.Printf("Reconfigure: %s", s)
+
+	if s.Ppm != old.Ppm {
+		err = tunerDo(func(d *rtlsdr.Context) error {
+			return d.SetFreqCorrection(s.Ppm)
+		})
+		if err != nil {
+			return false, fmt.Errorf("SetFreqCorrection %d ppm: %s", s.Ppm, err)
+		}
+	}
+	if s.Gain != old.Gain {
+		err = tunerDo(func(d *rtlsdr.Context) error {
+			if err := d.SetTunerGainMode(s.Gain != 0); err != nil {
+				return err
+			}
+			if s.Gain == 0 {
+				return nil
+			}
+			return d.SetTunerGain(s.Gain)
+		})
+		if err != nil {
+			if s.Ppm != old.Ppm {
+				tunerDo(func(d *rtlsdr.Context) error {
+					return d.SetFreqCorrection(old.Ppm)
+				})
+			}
+			return false, fmt.Errorf("SetTunerGain %d: %s", s.Gain, err)
+		}
+	}
+	ppm = s.Ppm
+	gain = s.Gain
+	fc = s.Fc
+	maxmissed = s.MaxMissed
+	if s.Tr != old.Tr {
+		setTransmitters(s.Tr)
+		log.Printf("tr=%d actChan=%d maxChan=%d", tr, actChan[0:maxChan], maxChan)
+		trChanged = true
+	}
+	return trChanged, nil
+}
+
+// setTransmitters converts the transmitter bitmask to actChan and
+// msgIdToChan. The per channel state of transmitters present before and
+// after the change moves along with them, so their sync is kept; new
+// transmitters start unsynchronized (chLastVisits zero, not lost).
+func setTransmitters(mask int) {
+	var (
+		lastVisits [8]int64
+		nextVisits [8]int64
+		totMsgs    [8]int
+		alarmCnts  [8]int
+		lastHops   [8]int
+		nextHops   [8]int
+		lost       [8]bool
+		lostAt     [8]int64
+		dwellHops  = [8]int{-1, -1, -1, -1, -1, -1, -1, -1}
+		skips      [8]int
+		skipRuns   [8]int
+		skipUntil  [8]int64
+	)
+	oldIdToChan := make([]int, len(msgIdToChan))
+	copy(oldIdToChan, msgIdToChan)
+
+	tr = mask
+	maxChan = 0
+	for i := range actChan {
+		actChan[i] = 0
+		msgIdToChan[i] = 9
+	}
+	for id := range actChan {
+		if mask&(1<<uint(id)) == 0 {
+			continue
+		}
+		actChan[maxChan] = id
+		msgIdToChan[id] = maxChan
+		if old := oldIdToChan[id]; old != 9 {
+			lastVisits[maxChan] = chLastVisits[old]
+			nextVisits[maxChan] = chNextVisits[old]
+			totMsgs[maxChan] = chTotMsgs[old]
+			alarmCnts[maxChan] = chAlarmCnts[old]
+			lastHops[maxChan] = chLastHops[old]
+			nextHops[maxChan] = chNextHops[old]
+			lost[maxChan] = chLost[old]
+			lostAt[maxChan] = chLostAt[old]
+			dwellHops[maxChan] = chDwellHops[old]
+			skips[maxChan] = chSkips[old]
+			skipRuns[maxChan] = chSkipRuns[old]
+			skipUntil[maxChan] = chSkipUntil[old]
+		}
+		maxChan++
+	}
+	chLastVisits = lastVisits
+	chNextVisits = nextVisits
+	chTotMsgs = totMsgs
+	chAlarmCnts = alarmCnts
+	chLastHops = lastHops
+	chNextHops = nextHops
+	chLost = lost
+	chLostAt = lostAt
+	chDwellHops = dwellHops
+	chSkips = skips
+	chSkipRuns = skipRuns
+	chSkipUntil = skipUntil
+	expectedChanPtr = 0
+	if logSchema == schemaLegacy && maxChan > 4 {
+		log.Printf("-schema %d logs the packet counters of the first four transmitters only, -schema %d those of all", schemaLegacy, schemaAllIDs)
+	}
+}
+
+// startControl serves the HTTP control endpoint:
+//
+//	GET  /settings  returns the current settings as JSON
+//	POST /settings  applies the settings in the JSON body; omitted fields
+//	                keep their current value
+func startControl(ctx context.Context, addr string, reconf chan<- reconfRequest) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	// ask forwards a request to the main loop unless we are stopping.
+	ask := func(req reconfRequest) (reconfReply, error) {
+		req.reply = make(chan reconfReply, 1)
+		select {
+		case reconf <- req:
+		case <-ctx.Done():
+			return reconfReply{}, ctx.Err()
+		}
+		select {
+		case r := <-req.reply:
+			return r, nil
+		case <-ctx.Done():
+			return reconfReply{}, ctx.Err()
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/settings", func(w http.ResponseWriter, r *http.Request) {
+		cur, err := ask(reconfRequest{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		switch r.Method {
+		case "GET":
+		case "POST", "PUT":
+			s := cur.current
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if cur, err = ask(reconfRequest{apply: true, settings: s}); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			if cur.err != nil {
+				http.Error(w, cur.err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cur.current)
+	})
+
+	srv := &http.Server{Handler: mux, ReadTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	log.Printf("Control endpoint listening on %s", ln.Addr())
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"census"
+	"protocol"
+
+	"github.com/jpoirier/gortlsdr"
+)
+
+// autoMargin is how much weaker than the strongest transmitter heard by
+// -tr auto a transmitter may be and still be taken for one of our own, in
+// dB.
+const autoMargin = 20
+
+var (
+	trAuto    bool  // -tr auto: detect the transmitters at startup
+	autoAdopt *bool // -autoadopt = listen for the detected transmitters without asking
+)
+
+// trValue is the -tr flag: a bitmask of transmitters, or auto.
+type trValue struct{}
+
+func (trValue) String() string {
+	if trAuto {
+		return "auto"
+	}
+	return strconv.Itoa(tr)
+}
+
+func (trValue) Set(s string) error {
+	if s == "auto" {
+		trAuto = true
+		return nil
+	}
+	mask, err := strconv.Atoi(s)
+	if err != nil || mask < 1 || mask > 255 {
+		return fmt.Errorf("expected a bitmask 1-255 or auto")
+	}
+	tr, trAuto = mask, false
+	return nil
+}
+
+// detectTransmitters listens through two hop cycles of the slowest
+// transmitter and returns the bitmask of the transmitters which are likely
+// our own, see census.Own. It goes through the hop sequence backwards, a
+// hop per period, so a transmitter hopping forwards comes by about twice per
+// cycle, on every channel. Settings applied through the control endpoint
+// meanwhile take effect; when they set the transmitters, those are taken.
+// It returns 0 and the exit status of the program when none was found, the
+// proposal is declined, a signal arrives or ctx is done.
+func detectTransmitters(ctx context.Context, p *protocol.Parser, blocks <-chan []byte, nextHop chan<- protocol.Hop, sig <-chan os.Signal,
+	reconf <-chan reconfRequest, tunerDo func(func(*rtlsdr.Context) error) error) (mask, status int) {
+	c := census.New()
+	wait := time.Duration(2*p.ChannelCount+2) * census.Period(7)
+	log.Printf("Auto: listening %s for the transmitters in range", wait.Round(time.Second))
+	hop := 0
+	nextHop <- withOffset(p.SetHop(hop))
+	step := time.NewTicker(census.Period(7))
+	defer step.Stop()
+	timer := time.After(wait)
+	for done := false; !done; {
+		select {
+		case s := <-sig:
+			log.Printf("Received %s: auto detection stopped", s)
+			return 0, 0
+		case <-ctx.Done():
+			return 0, 1
+		case req := <-reconf:
+			if !req.apply {
+				req.reply <- reconfReply{current: currentSettings()}
+				break
+			}
+			trChanged, err := applySettings(req.settings, tunerDo)
+			req.reply <- reconfReply{current: currentSettings(), err: err}
+			if trChanged {
+				log.Printf("Auto: detection ended by the control endpoint: -tr %d", tr)
+				return tr, 0
+			}
+		case <-step.C:
+			hop = (hop + p.ChannelCount - 1) % p.ChannelCount
+			nextHop <- withOffset(p.SetHop(hop))
+		case <-timer:
+			done = true
+		case block := <-blocks:
+			for _, msg := range p.Parse(p.Demodulate(block)) {
+				c.Add(censusPacket(msg, time.Now().UnixNano()))
+			}
+		}
+	}
+	logCensus(c)
+
+	ids := c.Own(autoMargin)
+	if len(ids) == 0 {
+		log.Printf("Auto: no transmitters found; check the antenna and -tf")
+		return 0, 1
+	}
+	var names []string
+	for _, id := range ids {
+		mask |= 1 << uint(id)
+		names = append(names, fmt.Sprintf("ID %d (Davis ID %d)", id, id+1))
+	}
+	log.Printf("Auto: found %s: -tr %d", strings.Join(names, ", "), mask)
+	if *autoAdopt {
+		return mask, 0
+	}
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		log.Printf("Auto: start again with -tr %d, or with -autoadopt to listen for them right away", mask)
+		return 0, 0
+	}
+	fmt.Fprintf(os.Stderr, "Listen for -tr %d? [Y/n] ", mask)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "" && a != "y" && a != "yes" {
+		log.Printf("Auto: declined; start again with the -tr of your transmitters")
+		return 0, 0
+	}
+	return mask, 0
+}
@@ -24,22 +24,32 @@
 package main
 
 import (
+    "context"
     "flag"
-    "io"
     "log"
+    "math"
     "math/rand"
     "os"
     "os/signal"
+    "sync"
+    "syscall"
     "time"
     "strconv"
+    "strings"
     "fmt"
 
+    "census"
+    "config"
+    "output"
     "protocol"
+    "sched"
+    "weather"
     "github.com/jpoirier/gortlsdr"
 )
 
 var (
     // program settings
+    tr                int            // -tr = bitmask of transmitters to listen for
     ex                int            // -ex = extra loopTime in msex
     fc                int            // -fc = frequency correction for all channels
     ppm               int            // -ppm = frequency correction of rtl dongle in ppm
@@ -47,9 +57,41 @@ var (
     maxmissed         int            // -maxmisssed = max missed-packets-in-a-row before new init
     transmitterFreq   *string        // -tf = transmitter frequencies, EU, or US
     undefined         *bool          // -un = log undefined signals
+    logSchema         int            // -schema = schema of the packet log line
     Debug             *bool           // -v = verbose debugging
     Disableafc        *bool          // -noafc = disable any automatic corrections
     deviceString      *string
+    stateFile         *string        // -state = file to persist receiver state across restarts
+    controlAddr       *string        // -ctl = listen address of the HTTP control endpoint
+    configFile        *string        // -config = configuration file
+    bucketSize        *string        // -bucket = rain bucket size, 0.01in or 0.2mm
+    latitude          float64        // -lat = station latitude in degrees
+    longitude         float64        // -lon = station longitude in degrees
+    altitude          float64        // -alt = station altitude in m
+    jsonOut           *string        // -json = JSON output file, - for stdout
+    influxOut         *string        // -influx = InfluxDB line protocol output
+    csvDir            *string        // -csv = directory for CSV files
+    csvRotate         *string        // -csvrotate = new CSV files every day or month
+    csvColumns        *string        // -csvcolumns = columns of the CSV readings files
+    mqttAddr          *string        // -mqtt = MQTT broker host:port
+    mqttUser          *string        // -mqttuser = MQTT user name
+    mqttPass          *string        // -mqttpass = MQTT password
+    mqttTopic         *string        // -mqtttopic = prefix of the MQTT topics
+    hassPrefix        *string        // -hass = Home Assistant discovery prefix
+    cwopCall          *string        // -cwop = CWOP callsign or id
+    cwopPass          *string        // -cwoppass = APRS-IS passcode
+    cwopServer        *string        // -cwopserver = APRS-IS server
+    cwopMinutes       int            // -cwopinterval = minutes between CWOP reports
+    wuID              *string        // -wu = Weather Underground station id
+    wuPass            *string        // -wupass = Weather Underground station key
+    wuURL             *string        // -wuurl = upload URL of the Weather Underground protocol
+    wuMinutes         int            // -wuinterval = minutes between uploads
+    wuRapid           *bool          // -wurapid = rapid fire updates
+    webhookURL        *string        // -webhook = URL to post health events to
+    dbPath            *string        // -db = SQLite database for packets and archive records
+    dbDays            int            // -dbdays = days the database keeps packets and records
+    archiveMinutes    int            // -archive = archive interval in minutes, 0 = no archive records
+    dayStart          *string        // -daystart = local time the daily highs and lows are reset
 
     // general
     actChan           [8]int         // list with actual channels (0-7); 
@@ -69,10 +111,21 @@ var (
     chLastHops        [8]int         // last hop channel-ids (sequential order)
     chNextHops        [8]int         // next hop channel-ids (sequential order)
     chMissPerFreq     [8][51]int     // transmitter missed per frequency channel
+    chLost            [8]bool        // lost sync; searched for while the others are tracked
+    chLostAt          [8]int64       // time sync was lost in UTC-nanoseconds
+    chDwellHops       [8]int         // hop (sequential order) a lost transmitter is awaited on; -1 = follow the prediction
+    chSkips           [8]int         // packets skipped by the scheduler because of a collision since startup
+    chSkipRuns        [8]int         // packets skipped in a row
+    chSkipUntil       [8]int64       // time of the last skipped packet in UTC-nanoseconds
 
     // per id (index is msg.ID)
     idLoopPeriods     [8]time.Duration // durations of one loop (higher IDs: longer durations)
     idUndefs          [8]int         // number of received messages of undefined id's since startup 
+    idCensus          *census.Census // what was heard of all id's with -u, else nil
+    idTrackers        [8]sched.Tracker // learned loop period and phase per id
+    idPackets         [8]int         // number of received messages per id in the current archive interval
+    idFreqErrors      [8]int         // frequency error of the last message per id in Hz
+    idRSSIs           [8]float64     // signal strength of the last message per id in dBFS
 
     // totals
     totInit           int            // total of init procedures since startup (first not counted)
@@ -88,6 +141,7 @@ var (
 
     // controll
     initTransmitrs    bool           // start an init session to synchronize all defined channels
+    searching         bool           // tuned to a lost transmitter until the next expected packet
     handleNxtPacket   bool           // start preparation for reading next data packet
 
     // init
@@ -108,52 +162,93 @@ var (
 
 
 func init() {
+    if isQuery() {
+        return
+    }
     VERSION := "0.12"
-var (
-    tr        int
-    mask    int
-)
     msgIdToChan = []int {9, 9, 9, 9, 9, 9, 9, 9, }    // preset with 9 (= undefined)
 
     log.SetFlags(log.Lmicroseconds)
     rand.Seed(time.Now().UnixNano())
 
     // read program settings
-    flag.IntVar(&tr, "tr", 1, "transmitters to listen for: tr1=1, tr2=2, tr3=4, tr4=8, tr5=16 tr6=32, tr7=64, tr8=128")
+    tr = 1
+    flag.Var(trValue{}, "tr", "transmitters to listen for: tr1=1, tr2=2, tr3=4, tr4=8, tr5=16 tr6=32, tr7=64, tr8=128, or auto to detect them")
+    autoAdopt = flag.Bool("autoadopt", false, "listen for the transmitters found by -tr auto without asking")
     flag.IntVar(&ex, "ex", 0, "extra loopPeriod time in msec")
     flag.IntVar(&fc, "fc", 0, "frequency correction in Hz for all channels")
     flag.IntVar(&ppm, "ppm", 0, "frequency correction of rtl dongle in ppm")
     flag.IntVar(&gain, "gain", 0, "tuner gain in tenths of Db")
     // supported gain values: 0, 9, 14, 27, 37, 77, 87, 125, 144, 157, 166, 197, 207,
     // 229, 254, 280, 297, 328, 338, 364, 372, 386, 402, 421, 434, 439, 445, 480, 496.
-    flag.IntVar(&maxmissed, "maxmissed", 51, "max missed-packets-in-a-row before new init")
+    flag.IntVar(&maxmissed, "maxmissed", 51, "max missed-packets-in-a-row before a transmitter is searched for again")
     flag.IntVar(&startFreq, "startfreq", 0, "test")
     flag.IntVar(&endFreq, "endfreq", 0, "test")
     flag.IntVar(&stepFreq, "stepfreq", 0, "test")
     transmitterFreq = flag.String("tf", "EU", "transmitter frequencies: EU or US")
-    undefined = flag.Bool("u", false, "log undefined signals")
+    undefined = flag.Bool("u", false, "log undefined signals and report a census of the transmitters heard")
+    flag.IntVar(&logSchema, "schema", schemaAllIDs, "packet log line: 2 = the counters of all eight IDs, 1 = of four transmitters, for older weewx-rtldavis versions")
     Debug = flag.Bool("v", false, "emit verbose debug messages")
     Disableafc = flag.Bool("noafc", false, "disable any AFC")
     deviceString = flag.String("d","0","device serial number or device index")
+    stateFile = flag.String("state", "", "file to persist receiver state across restarts")
+    controlAddr = flag.String("ctl", "", "listen address of the HTTP control endpoint, e.g. localhost:8081")
+    configFile = flag.String("config", "", "configuration file; command-line flags override its settings")
+    bucketSize = flag.String("bucket", "", "rain bucket size: 0.01in or 0.2mm (default by -tf)")
+    flag.Float64Var(&latitude, "lat", 0, "station latitude in degrees, north positive")
+    flag.Float64Var(&longitude, "lon", 0, "station longitude in degrees, east positive")
+    flag.Float64Var(&altitude, "alt", 0, "station altitude in m")
+    flag.IntVar(&archiveMinutes, "archive", 0, "archive interval in minutes: 1, 5, 10, 15, 30 or 60; 0 = no archive records")
+    dayStart = flag.String("daystart", "00:00", "local time HH:MM the daily highs and lows are reset")
+    influxOut = flag.String("influx", "", "write InfluxDB line protocol to this file, - for stdout, udp://host:port or an http(s):// write URL")
+    csvDir = flag.String("csv", "", "directory to write CSV files of the readings and packets to")
+    csvRotate = flag.String("csvrotate", "day", "start new CSV files every day or month")
+    csvColumns = flag.String("csvcolumns", "", "comma separated columns of the CSV readings files (default "+strings.Join(output.DefaultCSVColumns, ",")+")")
+    mqttAddr = flag.String("mqtt", "", "MQTT broker host:port to publish to")
+    mqttUser = flag.String("mqttuser", "", "MQTT user name")
+    mqttPass = flag.String("mqttpass", "", "MQTT password")
+    mqttTopic = flag.String("mqtttopic", "rtldavis", "prefix of the MQTT topics")
+    hassPrefix = flag.String("hass", "", "announce the transmitters to Home Assistant under this MQTT discovery prefix, e.g. homeassistant")
+    cwopCall = flag.String("cwop", "", "submit weather reports to CWOP with this callsign or CWOP id")
+    cwopPass = flag.String("cwoppass", "-1", "APRS-IS passcode; -1 for CWOP ids")
+    cwopServer = flag.String("cwopserver", "cwop.aprs.net:14580", "APRS-IS server host:port")
+    flag.IntVar(&cwopMinutes, "cwopinterval", 10, "minutes between CWOP reports")
+    wuID = flag.String("wu", "", "upload to Weather Underground (or -wuurl) with this station id")
+    wuPass = flag.String("wupass", "", "Weather Underground station key")
+    wuURL = flag.String("wuurl", output.WUURL, "upload URL, e.g. "+output.PWSWeatherURL+" for PWSWeather")
+    flag.IntVar(&wuMinutes, "wuinterval", 5, "minutes between uploads")
+    wuRapid = flag.Bool("wurapid", false, "send every packet as a rapid fire update")
+    webhookURL = flag.String("webhook", "", "URL to post transmitter health events to as JSON")
+    dbPath = flag.String("db", "", "SQLite database to store packets and archive records in")
+    flag.IntVar(&dbDays, "dbdays", 30, "days the database keeps packets and archive records; 0 = forever")
+    jsonOut = flag.String("json", "", "write the conditions as JSON lines to this file, - for stdout")
 
 
 
     flag.Parse()
+    if *configFile != "" {
+        if err := loadConfig(*configFile); err != nil {
+            log.Fatal(err)
+        }
+    } else {
+        setTransmitterConfig(&config.Config{})
+    }
+    if logSchema != schemaLegacy && logSchema != schemaAllIDs {
+        log.Fatalf("unknown -schema %d, expected %d or %d", logSchema, schemaLegacy, schemaAllIDs)
+    }
     protocol.Debug = *Debug
     protocol.Disableafc = *Disableafc
+    if *undefined {
+        idCensus = census.New()
+    }
 
 
     log.Printf("rtldavis.go VERSION=%s", VERSION)
     // convert tranceiver code to act channels
-    mask = 1
-    for i := range actChan {
-        if tr & mask != 0 {
-            actChan[maxChan] = i
-            msgIdToChan[i] = maxChan
-            maxChan += 1
-        }
-        mask = mask << 1
+    if trAuto {
+        tr = 0  // until detected
     }
+    setTransmitters(tr)
     log.Printf("tr=%d fc=%d ppm=%d gain=%d ex=%d maxmissed=%d actChan=%d maxChan=%d", tr, fc, ppm, gain, ex, maxmissed, actChan[0:maxChan], maxChan) 
 
     // Preset loopperiods per id
@@ -161,17 +256,55 @@ var (
     for i := 1; i < 8; i++ {
         idLoopPeriods[i] = idLoopPeriods[i-1] + 62500 * time.Microsecond
     }
+    for i := range idTrackers {
+        idTrackers[i] = sched.NewTracker(idLoopPeriods[i])
+        idTrackers[i].SetRelayed(trConfig[i].Repeater != 0)
+        idRSSIs[i] = math.NaN()
+    }
+    bucket, err := parseBucket(*bucketSize, *transmitterFreq)
+    if err != nil {
+        log.Fatal(err)
+    }
+    station = weather.NewStation(bucket)
+    station.Lat, station.Lon, station.Alt = latitude, longitude, altitude
+    if station.Stats.DayStart, err = parseDayStart(*dayStart); err != nil {
+        log.Fatal(err)
+    }
+    if archiveMinutes != 0 {
+        if archive, err = newArchive(archiveMinutes); err != nil {
+            log.Fatal(err)
+        }
+    }
+    // with -tr auto the outputs are opened once the transmitters are known
+    if !trAuto {
+        if outputs, err = openOutputs(); err != nil {
+            log.Fatal(err)
+        }
+    }
 
     // check if test
     if startFreq != 0 && endFreq !=0 && stepFreq != 0 {
         log.Printf("TEST: startFreq=%d endFreq=%d stepFreq=%d", startFreq, endFreq, stepFreq)
         testFreq = true
         testChannelFreq = startFreq - stepFreq
+        if trAuto {
+            log.Fatal("-tr auto can not be combined with a frequency test")
+        }
     }
 
 }
 
 func main() {
+    if isQuery() {
+        os.Exit(runQuery(os.Args[2:]))
+    }
+    os.Exit(run())
+}
+
+// run receives until SIGINT/SIGTERM (or the end of a frequency test) and
+// returns the exit status of the program after all goroutines are drained
+// and the receiver state is saved.
+func run() (status int) {
     var sdrIndex int = -1
     p := protocol.NewParser(14, *transmitterFreq)
     p.Cfg.Log()
@@ -226,7 +359,7 @@ func main() {
             for i := 0; i < len(gains); i++ {
                 gainInfo += fmt.Sprintf("%d Db ", int(gains[i]))
             }
-	    log.Printf(gainInfo)
+	    log.Print(gainInfo)
         }
         err = dev.SetTunerGain(gain)
         if err != nil {
@@ -250,26 +383,78 @@ func main() {
         log.Fatal(err)
     }
 
-    in, out := io.Pipe()
+    if *stateFile != "" {
+        if err := loadState(*stateFile, &p); err != nil {
+            log.Printf("State %s not loaded: %s", *stateFile, err)
+        }
+    }
 
-    go dev.ReadAsync(func(buf []byte) {
-        out.Write(buf)
-    }, nil, 1, p.Cfg.BlockSize2)
+    // The lifecycle of the reader and hop goroutines is bound to ctx; stop
+    // records the exit status and cancels it.
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    exitCode := 0
+    var stopOnce sync.Once
+    stop := func(code int) {
+        stopOnce.Do(func() {
+            exitCode = code
+            cancel()
+        })
+    }
 
+    // The callback owns buf only for the duration of the call, so hand a
+    // copy to the main loop. Never block the callback once we are stopping.
+    blocks := make(chan []byte, 16)
+    readerDone := make(chan struct{})
+    go func() {
+        defer close(readerDone)
+        err := dev.ReadAsync(func(buf []byte) {
+            block := make([]byte, len(buf))
+            copy(block, buf)
+            select {
+            case blocks <- block:
+            case <-ctx.Done():
+            }
+        }, nil, 1, p.Cfg.BlockSize2)
+        if err != nil && ctx.Err() == nil {
+            log.Printf("ReadAsync error: %s", err)
+            stop(1)
+        }
+    }()
 
     // Handle frequency hops concurrently since the callback will stall if we
     // stop reading to hop.
+    // Other tuner settings are changed by the same goroutine, so the device
+    // is never driven from two goroutines at once.
     nextHop := make(chan protocol.Hop, 1)
+    tuner := make(chan func(*rtlsdr.Context))
+    hopDone := make(chan struct{})
     go func() {
-        for hop := range nextHop {
+        defer close(hopDone)
+        for {
+            var hop protocol.Hop
+            select {
+            case f := <-tuner:
+                f(dev)
+                continue
+            case h, ok := <-nextHop:
+                if !ok {
+                    return
+                }
+                hop = h
+            }
+            if ctx.Err() != nil {
+                continue  // drain remaining hops without touching the tuner
+            }
             freqError = hop.FreqError
             if testFreq {
                 freqCorrection = 0
                 testChannelFreq = testChannelFreq + stepFreq
                 testNumber++ 
                 if testChannelFreq > endFreq {
-                    endmsg := "Test reached endfreq; test ended"
-                    log.Fatal(endmsg)
+                    log.Printf("Test reached endfreq; test ended")
+                    stop(0)
+                    continue
                 }
                 channelFreq = testChannelFreq
             } else {
@@ -281,7 +466,7 @@ func main() {
             if *Disableafc {freqCorrection=0}
             if *Debug {log.Printf("Applied Correction: %d",freqCorrection)}
             
-            if err := dev.SetCenterFreq(channelFreq + freqCorrection + fc); err != nil {
+            if err := dev.SetCenterFreq(channelFreq + freqCorrection + hop.Offset); err != nil {
                 //log.Fatal(err)  // no reason top stop program for one error
                 log.Printf("SetCenterFreq: %d error: %s", hop.ChannelFreq, err)
             }
@@ -289,29 +474,211 @@ func main() {
     }()
 
     defer func() {
-        in.Close()
-        out.Close()
-        dev.CancelAsync()
-        dev.Close()
-        os.Exit(0)
+        // Stop hopping first, then the reader, and only then release the
+        // device; persist state before closing the outputs, which may wait
+        // for a network service, so it is saved before a stop timeout.
+        close(nextHop)
+        <-hopDone
+        if err := dev.CancelAsync(); err != nil {
+            log.Printf("CancelAsync error: %s", err)
+        }
+        <-readerDone
+        if err := dev.Close(); err != nil {
+            log.Printf("Close device error: %s", err)
+        }
+        if *stateFile != "" {
+            if err := saveState(*stateFile, &p); err != nil {
+                log.Printf("State %s not saved: %s", *stateFile, err)
+                if status == 0 {
+                    status = 1
+                }
+            }
+        }
+        for _, o := range outputs {
+            if err := o.Close(); err != nil {
+                log.Printf("Close output error: %s", err)
+            }
+        }
+        if idCensus != nil {
+            logCensus(idCensus)
+        }
+        log.Printf("rtldavis stopped (exit status %d)", status)
     }()
 
     sig := make(chan os.Signal, 1)
-    signal.Notify(sig, os.Interrupt, os.Kill)
+    signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+    defer signal.Stop(sig)
+    hup := make(chan os.Signal, 1)
+    signal.Notify(hup, syscall.SIGHUP)
+    defer signal.Stop(hup)
+
+    reconf := make(chan reconfRequest)
+    if *controlAddr != "" {
+        if err := startControl(ctx, *controlAddr, reconf); err != nil {
+            log.Printf("Control endpoint %s not started: %s", *controlAddr, err)
+        }
+    }
+    // tunerDo runs f on the hop goroutine and waits for its result.
+    tunerDo := func(f func(*rtlsdr.Context) error) error {
+        errc := make(chan error, 1)
+        tuner <- func(d *rtlsdr.Context) { errc <- f(d) }
+        return <-errc
+    }
+    var loopTimer <-chan time.Time
+    // archiveTimer expires at archiveEnd, the end of the archive interval
+    var archiveTimer <-chan time.Time
+    var archiveEnd time.Time
+    statsTicker := time.NewTicker(time.Minute)
+    defer statsTicker.Stop()
+    var censusTick <-chan time.Time
+    if idCensus != nil {
+        censusTicker := time.NewTicker(time.Hour)
+        defer censusTicker.Stop()
+        censusTick = censusTicker.C
+    }
+    if archive != nil {
+        archiveEnd = weather.NextBoundary(time.Now(), archive.Interval)
+        archiveTimer = time.After(time.Until(archiveEnd))
+    }
+    // startInit forgets the sync of all transmitters and waits on hop 0
+    // for a message of each of them.
+    startInit := func() {
+        for i := 0; i < maxChan; i++ {
+            chLastVisits[i] = 0
+            chLost[i] = false
+        }
+        initTransmitrs = true
+        searching = false
+        visitCount = 0
+        totInit++
+        loopPeriod = time.Duration(maxFreq +2) * idLoopPeriods[actChan[maxChan-1]]
+        loopTimer = time.After(loopPeriod)
+        log.Printf("Init channels: wait max %d seconds for a message of each transmitter", loopPeriod/1000000000)
+        nextHop <- withOffset(p.SetHop(0))
+    }
+    // hopExpected hops to the channel of the next expected packet.
+    hopExpected := func() {
+        searching = false
+        nextHopChan = chNextHops[expectedChanPtr]
+        loopPeriod = receiveTimeout()
+        loopTimer = time.After(loopPeriod)
+        nextHop <- withOffset(p.SetHopTr(nextHopChan,actChan[expectedChanPtr]))
+    }
+    // scheduleNext calculates the next expected packet and hops to its
+    // channel. While a transmitter is lost, the time until then is spent
+    // listening for the lost transmitter instead.
+    scheduleNext := func() {
+        HandleNextHopChannel()
+        if lost := searchTarget(); lost >= 0 {
+            guard := idTrackers[actChan[expectedChanPtr]].Window() + 50 * time.Millisecond
+            if until := time.Duration(chNextVisits[expectedChanPtr] - curTime) - guard; until > 100 * time.Millisecond {
+                searching = true
+                loopTimer = time.After(until)
+                nextHop <- withOffset(p.SetHopTr(searchHop(lost), actChan[lost]))
+                return
+            }
+        }
+        hopExpected()
+    }
+    // reconfigure applies new settings and, when the set of transmitters
+    // changed, recalculates the hop schedule.
+    reconfigure := func(s settings) error {
+        trChanged, err := applySettings(s, tunerDo)
+        if !trChanged || testFreq {
+            return err
+        }
+        curTime = time.Now().UnixNano()
+        visitCount = 0
+        for i := 0; i < maxChan; i++ {
+            if chLastVisits[i] != 0 {
+                visitCount++
+            }
+        }
+        if initTransmitrs {
+            if visitCount < maxChan {
+                return err  // init keeps waiting for the new transmitters
+            }
+            // the transmitters still awaited during init were removed
+            initTransmitrs = false
+        }
+        // new transmitters are searched for while the transmitters already
+        // in sync keep their timing
+        tracked := false
+        for i := 0; i < maxChan; i++ {
+            if chLastVisits[i] == 0 {
+                log.Printf("ID:%d search on hop 0", actChan[i])
+                chLost[i] = true
+                chLostAt[i] = curTime
+                chDwellHops[i] = 0
+            }
+            tracked = tracked || !chLost[i]
+        }
+        if tracked {
+            scheduleNext()
+        } else {
+            startInit()
+        }
+        return err
+    }
 
-    block := make([]byte, p.Cfg.BlockSize2)
-    initTransmitrs = true
     maxFreq = p.ChannelCount
+    if trAuto {
+        mask, status := detectTransmitters(ctx, &p, blocks, nextHop, sig, reconf, tunerDo)
+        if mask == 0 {
+            stop(status)
+            return exitCode
+        }
+        setTransmitters(mask)
+        log.Printf("tr=%d actChan=%d maxChan=%d", tr, actChan[0:maxChan], maxChan)
+        var err error
+        if outputs, err = openOutputs(); err != nil {
+            log.Printf("Outputs not opened: %s", err)
+            stop(1)
+            return exitCode
+        }
+    }
+    initTransmitrs = true
 
     // Set the idLoopPeriods for one full rotation of the pattern + 1. 
     loopPeriod = time.Duration(maxFreq +2) * idLoopPeriods[actChan[maxChan-1]]
-    loopTimer := time.After(loopPeriod)  // loopTimer of highest transmitter
+    loopTimer = time.After(loopPeriod)  // loopTimer of highest transmitter
     log.Printf("Init channels: wait max %d seconds for a message of each transmitter", loopPeriod/1000000000)
 
     for {
         select {
-        case <-sig:
-            return
+        case s := <-sig:
+            log.Printf("Received %s: shutting down", s)
+            stop(0)
+            return exitCode
+        case <-ctx.Done():
+            return exitCode
+        case <-hup:
+            if s, cfg, ok := reloadConfig(&p); ok {
+                if err := reconfigure(s); err != nil {
+                    log.Printf("Reconfigure failed: %s; transmitter configuration not reloaded", err)
+                } else {
+                    setTransmitterConfig(cfg)
+                    announceDevices()
+                }
+            }
+        case req := <-reconf:
+            if !req.apply {
+                req.reply <- reconfReply{current: currentSettings()}
+                break
+            }
+            err := reconfigure(req.settings)
+            if err == nil {
+                announceDevices()
+            }
+            req.reply <- reconfReply{current: currentSettings(), err: err}
+        case <-statsTicker.C:
+            writeStats()
+        case <-censusTick:
+            logCensus(idCensus)
+        case <-archiveTimer:
+            writeArchive(archiveEnd)
+            archiveEnd = weather.NextBoundary(archiveEnd, archive.Interval)
+            archiveTimer = time.After(time.Until(archiveEnd))
         case <-loopTimer:
             // If the loopTimer has expired one of two things has happened:
             //     1: We've missed a message.
@@ -324,50 +691,46 @@ func main() {
                 }
                 loopPeriod = time.Duration(maxFreq +2) * idLoopPeriods[actChan[maxChan-1]]
                 loopTimer = time.After(loopPeriod)
-                nextHop <- p.SetHop(0)
+                nextHop <- withOffset(p.SetHop(0))
+            } else if searching {
+                // back from searching to the next expected packet
+                curTime = time.Now().UnixNano()
+                hopExpected()
             } else {
                 if !initTransmitrs {
                     // packet missed
                     curTime = time.Now().UnixNano()
                     // forget the handling of this channel; update lastVisitTime as if the packet was received
-                    chLastVisits[expectedChanPtr] += int64(idLoopPeriods[actChan[expectedChanPtr]])
+                    chLastVisits[expectedChanPtr] += int64(idTrackers[actChan[expectedChanPtr]].Period())
+                    idTrackers[actChan[expectedChanPtr]].Miss()
                     // update chLastHops as if the packet was received
                     chLastHops[expectedChanPtr] = (chLastHops[expectedChanPtr] + 1) % maxFreq
                     // increase missed counters
                     chAlarmCnts[expectedChanPtr]++
                     chMissPerFreq[actChan[expectedChanPtr]][p.SeqToHop(nextHopChan)]++
-                    log.Printf("ID:%d packet missed (%d), missed per freq: %d", actChan[expectedChanPtr], chAlarmCnts[expectedChanPtr], chMissPerFreq[actChan[expectedChanPtr]][0:maxFreq])
+                    log.Printf("ID:%d packet missed (%d), missed per freq: %d (%s)", actChan[expectedChanPtr], chAlarmCnts[expectedChanPtr], chMissPerFreq[actChan[expectedChanPtr]][0:maxFreq], trName(actChan[expectedChanPtr]))
                     
+                    if chAlarmCnts[expectedChanPtr] > maxmissed {
+                        chAlarmCnts[expectedChanPtr] = 0   // reset current alarm count
+                        loseTransmitter(expectedChanPtr)
+                    }
+                    // only when no transmitter is left to follow, start all over
+                    initTransmitrs = true
                     for i := 0; i < maxChan; i++ {
-                        if chAlarmCnts[i] > maxmissed {
-                            chAlarmCnts[i] = 0   // reset current alarm count
-                            initTransmitrs = true
+                        if !chLost[i] {
+                            initTransmitrs = false
                         }
                     }
                 }
                 // test again; situation may have changed
                 if !initTransmitrs {
-                    HandleNextHopChannel()
-                    nextHopChan = chNextHops[expectedChanPtr]
-                    loopPeriod = time.Duration(chNextVisits[expectedChanPtr] - curTime + int64(62500 * time.Microsecond) + int64((ex + 10) * 1000000))
-                    loopTimer = time.After(loopPeriod)
-                    nextHop <- p.SetHop(nextHopChan)
+                    scheduleNext()
                 } else {
-                    // reset chLastVisits
-                    for i := 0; i < maxChan; i++ {
-                        chLastVisits[i] = 0
-                    }
-                    visitCount = 0
-                    totInit++
-                    loopPeriod = time.Duration(maxFreq +2) * idLoopPeriods[actChan[maxChan-1]]
-                    loopTimer = time.After(loopPeriod)
-                    log.Printf("Init channels: wait max %d seconds for a message of each transmitter", loopPeriod/1000000000)
-                    nextHop <- p.SetHop(0)
+                    startInit()
                 }
             }
 
-        default:
-            in.Read(block)
+        case block := <-blocks:
             handleNxtPacket = false
             for _, msg := range p.Parse(p.Demodulate(block)) {
                 if testFreq {
@@ -376,13 +739,27 @@ func main() {
                             log.Printf("TESTFREQ %d: Frequency %d (freqError=%d): OK, msg.data: %02X", testNumber, testChannelFreq, freqError, msg.Data)
                             loopPeriod = time.Duration(maxFreq +2) * idLoopPeriods[actChan[maxChan-1]]
                             loopTimer = time.After(loopPeriod)
-                            nextHop <- p.SetHop(0)
+                            nextHop <- withOffset(p.SetHop(0))
                         }
                     }
                     continue  // read next message
                 }
                 curTime = time.Now().UnixNano()
                 //log.Printf("msg.Data: %02X", msg.Data)
+                // the census counts the packets of every path
+                if idCensus != nil && string(msg.Data) != lastRecMsg {
+                    idCensus.Add(censusPacket(msg, curTime))
+                }
+                // A transmitter is tracked on one path only, directly or
+                // through its repeater: the copy on the other path arrives
+                // at another time and would throw the tracker off.
+                if msgIdToChan[int(msg.ID)] != 9 && msg.Repeater != trConfig[msg.ID].Repeater {
+                    if *Debug {
+                        log.Printf("ID:%d packet via %s ignored, expected via %s", msg.ID,
+                            protocol.RepeaterName(msg.Repeater), protocol.RepeaterName(trConfig[msg.ID].Repeater))
+                    }
+                    continue  // read next message
+                }
                 // Keep track of duplicate packets
                 seen := string(msg.Data)
                 if seen == lastRecMsg {
@@ -393,19 +770,25 @@ func main() {
                 // check if msg comes from undefined sensor
                 if msgIdToChan[int(msg.ID)] == 9 {
                     if *undefined {
-                        log.Printf("undefined: %02X ID=%d", msg.Data, msg.ID)
+                        if msg.Repeater != 0 {
+                            log.Printf("undefined: %02X ID=%d via=%s", msg.Data, msg.ID, protocol.RepeaterName(msg.Repeater))
+                        } else {
+                            log.Printf("undefined: %02X ID=%d", msg.Data, msg.ID)
+                        }
                     }
                     idUndefs[int(msg.ID)]++
                     continue  // read next message
                 } else {
                     chTotMsgs[msgIdToChan[int(msg.ID)]]++
+                    idPackets[msg.ID]++
                     chAlarmCnts[msgIdToChan[int(msg.ID)]] = 0  // reset current missed count
                     if initTransmitrs {
                         if chLastVisits[msgIdToChan[int(msg.ID)]] == 0 {
                             visitCount +=1
                             chLastVisits[msgIdToChan[int(msg.ID)]] = curTime
+                            idTrackers[msg.ID].Reset(curTime)
                             chLastHops[msgIdToChan[int(msg.ID)]] = p.HopToSeq(actHopChanIdx)
-                            log.Printf("TRANSMITTER %d SEEN", msg.ID)
+                            log.Printf("TRANSMITTER %d SEEN (%s)", msg.ID, trName(int(msg.ID)))
                             if visitCount == maxChan {
                                 if maxChan > 1 {
                                     log.Printf("ALL TRANSMITTERS SEEN")
@@ -415,28 +798,35 @@ func main() {
                             }
                         } else {
                             chLastVisits[msgIdToChan[int(msg.ID)]] = curTime  // update chLastVisits timer 
+                            idTrackers[msg.ID].Update(curTime)
+                            chLastHops[msgIdToChan[int(msg.ID)]] = p.HopToSeq(actHopChanIdx)
                         }
                     } else {
                         // normal hopping
                         chLastHops[msgIdToChan[int(msg.ID)]] = p.HopToSeq(actHopChanIdx)
                         chLastVisits[msgIdToChan[int(msg.ID)]] = curTime
-                        if *undefined {
-                            log.Printf("%02X %d %d %d %d %d msg.ID=%d undefined:%d", 
-                                msg.Data, chTotMsgs[0], chTotMsgs[1], chTotMsgs[2], chTotMsgs[3], totInit, msg.ID, idUndefs)
-                        } else {
-                            log.Printf("%02X %d %d %d %d %d msg.ID=%d", 
-                                msg.Data, chTotMsgs[0], chTotMsgs[1], chTotMsgs[2], chTotMsgs[3], totInit, msg.ID) 
+                        chSkipRuns[msgIdToChan[int(msg.ID)]] = 0
+                        resynced := chLost[msgIdToChan[int(msg.ID)]]
+                        if resynced {
+                            chLost[msgIdToChan[int(msg.ID)]] = false
+                            idTrackers[msg.ID].Reset(curTime)
+                            log.Printf("TRANSMITTER %d RESYNCED (%s)", msg.ID, trName(int(msg.ID)))
                         }
+                        handleData(msg, convTim(curTime))
+                        // a reset tracker already has this arrival
+                        if !resynced {
+                            residual := idTrackers[msg.ID].Update(curTime)
+                            if *Debug {
+                                log.Printf("ID:%d arrival off by %s, period %s, window %s", msg.ID, residual, idTrackers[msg.ID].Period(), idTrackers[msg.ID].Window())
+                            }
+                        }
+                        log.Print(packetLine(msg))
                         handleNxtPacket = true
                     }
                 }
             }
             if handleNxtPacket {
-                HandleNextHopChannel()
-                nextHopChan = chNextHops[expectedChanPtr]
-                loopPeriod = time.Duration(chNextVisits[expectedChanPtr] - curTime + int64(62500 * time.Microsecond) + int64((ex + 10) * 1000000))
-                loopTimer = time.After(loopPeriod)
-                nextHop <- p.SetHopTr(nextHopChan,actChan[expectedChanPtr])
+                scheduleNext()
             }
         }
     }
@@ -455,29 +845,113 @@ func HandleNextHopChannel() {
     // check lastVisits; zero values should not happen,
     // but when it does the program will be very busy (c.q. hang)
     for i := 0; i < maxChan; i++ {
-        if chLastVisits[i] == 0 {
+        if chLastVisits[i] == 0 && !chLost[i] {
             log.Printf("ERROR: chLastVisits[%d] should not be zero!", i)
             chLastVisits[i] = curTime  // workaround to get further
+            idTrackers[actChan[i]].Reset(curTime)
         }
     }
-    for i := 0; i < 8; i++ {
-        if msgIdToChan[i] < 9 {
-            for chNextVisits[msgIdToChan[i]] = chLastVisits[msgIdToChan[i]]; chNextVisits[msgIdToChan[i]] <= curTime; chNextVisits[msgIdToChan[i]] += int64(idLoopPeriods[actChan[msgIdToChan[i]]]) {
-                chNextHops[msgIdToChan[i]] = (chNextHops[msgIdToChan[i]] + 1) % maxFreq
-            }
+    // predict the next visits with the learned period and phase
+    for i := 0; i < maxChan; i++ {
+        if chLost[i] && chDwellHops[i] >= 0 {
+            continue  // no usable prediction
+        }
+        next, periods := idTrackers[actChan[i]].Next(curTime)
+        chNextVisits[i] = next
+        chNextHops[i] = (chLastHops[i] + periods) % maxFreq
+    }
+    // don't expect packets the scheduler already decided to skip
+    for i := 0; i < maxChan; i++ {
+        if !chLost[i] && chNextVisits[i] <= chSkipUntil[i] {
+            next, periods := idTrackers[actChan[i]].Next(chSkipUntil[i])
+            chNextVisits[i] = next
+            chNextHops[i] = (chLastHops[i] + periods) % maxFreq
         }
     }
-    expectedChanPtr = Min(chNextVisits[0:maxChan])
+    // the next expected packet is the first of a transmitter in sync, unless
+    // it collides with the packet of a transmitter with a higher priority
+    var cands []sched.Candidate
+    var ptrs []int
+    for i := 0; i < maxChan; i++ {
+        if !chLost[i] {
+            cands = append(cands, sched.Candidate{At: chNextVisits[i], Window: idTrackers[actChan[i]].Window(), Priority: trPriority(actChan[i]), Skipped: chSkipRuns[i]})
+            ptrs = append(ptrs, i)
+        }
+    }
+    serve, skip := sched.Choose(cands)
+    if serve < 0 {
+        log.Printf("ERROR: no transmitter in sync to expect")
+        expectedChanPtr = 0
+        return
+    }
+    expectedChanPtr = ptrs[serve]
+    for _, k := range skip {
+        i := ptrs[k]
+        chSkips[i]++
+        chSkipRuns[i]++
+        chSkipUntil[i] = chNextVisits[i]
+        log.Printf("ID:%d packet skipped for ID:%d (collision), skipped: %d", actChan[i], actChan[expectedChanPtr], chSkips[i])
+    }
 }
 
-func Min(values []int64) (ptr int) {
-    var min int64
-    min = values[0]
+// loseTransmitter marks the transmitter at channel ptr i as lost. A lost
+// transmitter is no longer waited for, but searched for in between the
+// packets of the transmitters still in sync.
+func loseTransmitter(i int) {
+    log.Printf("TRANSMITTER %d LOST (%s)", actChan[i], trName(actChan[i]))
+    chLost[i] = true
+    chLostAt[i] = curTime
+    chDwellHops[i] = -1
+}
+
+// searchTarget returns the channel ptr of the lost transmitter to search
+// for: the one expected first. It returns -1 when no transmitter is lost.
+func searchTarget() (ptr int) {
+    ptr = -1
     for i := 0; i < maxChan; i++ {
-        if (values[i] < min) {
-            min = values[i]
+        if !chLost[i] {
+            continue
+        }
+        // prefer a transmitter we still have a prediction for
+        if ptr < 0 || chDwellHops[ptr] >= 0 && chDwellHops[i] < 0 {
+            ptr = i
+        } else if chDwellHops[ptr] < 0 && chDwellHops[i] < 0 && chNextVisits[i] < chNextVisits[ptr] {
             ptr = i
         }
     }
     return ptr
 }
+
+// searchHop returns the hop (sequential order) to listen on for lost
+// transmitter i. For one hop cycle after losing it we follow its predicted
+// hops, as a short loss usually leaves the timing intact; the windows in
+// between the other transmitters are much wider than the normal window.
+// After that we dwell on one channel, which the transmitter is bound to
+// visit once per hop cycle.
+func searchHop(i int) int {
+    if chDwellHops[i] < 0 && curTime - chLostAt[i] > int64(maxFreq) * int64(idTrackers[actChan[i]].Period()) {
+        chDwellHops[i] = chNextHops[i]
+        log.Printf("ID:%d search on hop %d", actChan[i], chDwellHops[i])
+    }
+    if chDwellHops[i] >= 0 {
+        return chDwellHops[i]
+    }
+    return chNextHops[i]
+}
+
+// receiveTimeout returns how long to listen for the expected transmitter:
+// until its predicted arrival plus the receive window of its tracker, but
+// not so long that a late or missed packet also costs the packet of the
+// next transmitter.
+func receiveTimeout() time.Duration {
+    end := chNextVisits[expectedChanPtr] + int64(idTrackers[actChan[expectedChanPtr]].Window()) + int64(ex) * int64(time.Millisecond)
+    for i := 0; i < maxChan; i++ {
+        if i == expectedChanPtr || chLost[i] || chNextVisits[i] <= chSkipUntil[i] || chNextVisits[i] < chNextVisits[expectedChanPtr] {
+            continue
+        }
+        if limit := chNextVisits[i] - int64(sched.SwitchTime); limit < end {
+            end = limit
+        }
+    }
+    return time.Duration(end - curTime)
+}
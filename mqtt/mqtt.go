@@ -0,0 +1,265 @@
+// Package mqtt is a minimal MQTT 3.1.1 client. It only publishes, with QoS
+// 0, which is all the receiver needs, and keeps the connection alive.
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// packet types
+const (
+	connect    = 1
+	connack    = 2
+	publish    = 3
+	pingreq    = 12
+	pingresp   = 13
+	disconnect = 14
+)
+
+// Message is a message to publish.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options are the options of a connection.
+type Options struct {
+	Addr      string // host:port
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration // 0 = 60s
+	Will      *Message      // published by the broker when the connection is lost
+}
+
+// ErrClosed is returned when publishing on a closed or lost connection.
+var ErrClosed = errors.New("mqtt: connection closed")
+
+// Client is a connection to a broker.
+type Client struct {
+	conn net.Conn
+	mu   sync.Mutex // serializes writes
+	done chan struct{}
+
+	errMu sync.Mutex
+	err   error
+}
+
+// connackErrors are the CONNACK return codes.
+var connackErrors = []string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// Dial connects to the broker and waits for it to accept the connection.
+func Dial(opt Options) (*Client, error) {
+	if opt.KeepAlive == 0 {
+		opt.KeepAlive = 60 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", opt.Addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(connectPacket(opt)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	typ, body, err := readPacket(r)
+	if err == nil && (typ != connack || len(body) != 2) {
+		err = fmt.Errorf("mqtt: expected CONNACK, got packet type %d", typ)
+	}
+	if err == nil && body[1] != 0 {
+		err = fmt.Errorf("mqtt: connection refused: return code %d", body[1])
+		if int(body[1]) < len(connackErrors) {
+			err = fmt.Errorf("mqtt: connection refused: %s", connackErrors[body[1]])
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	c := &Client{conn: conn, done: make(chan struct{})}
+	go c.read(r, opt.KeepAlive)
+	go c.ping(opt.KeepAlive)
+	return c, nil
+}
+
+// read consumes what the broker sends, which for a QoS 0 publisher is only
+// PINGRESP, and notices a lost connection.
+func (c *Client) read(r *bufio.Reader, keepAlive time.Duration) {
+	var err error
+	for err == nil {
+		c.conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		_, _, err = readPacket(r)
+	}
+	c.fail(err)
+}
+
+// ping keeps the connection alive.
+func (c *Client) ping(keepAlive time.Duration) {
+	t := time.NewTicker(keepAlive / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := c.write([]byte{pingreq << 4, 0}); err != nil {
+				c.fail(err)
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// fail records the first error and closes the connection.
+func (c *Client) fail(err error) {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if c.err != nil {
+		return
+	}
+	if err == io.EOF {
+		err = ErrClosed
+	}
+	c.err = err
+	close(c.done)
+	c.conn.Close()
+}
+
+// Err returns why the connection was lost, nil while it is up.
+func (c *Client) Err() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
+func (c *Client) write(p []byte) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(p)
+	return err
+}
+
+// Publish publishes m with QoS 0.
+func (c *Client) Publish(m Message) error {
+	var flags byte
+	if m.Retain {
+		flags = 1
+	}
+	body := appendString(nil, m.Topic)
+	body = append(body, m.Payload...)
+	if err := c.write(packet(publish<<4|flags, body)); err != nil {
+		c.fail(err)
+		return err
+	}
+	return nil
+}
+
+// Close disconnects from the broker.
+func (c *Client) Close() error {
+	err := c.write([]byte{disconnect << 4, 0})
+	c.fail(ErrClosed)
+	if err == ErrClosed {
+		err = nil
+	}
+	return err
+}
+
+func connectPacket(opt Options) []byte {
+	flags := byte(0x02) // clean session
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, 0, 0, 0) // level 3.1.1, flags and keep alive below
+	payload := appendString(nil, opt.ClientID)
+	if opt.Will != nil {
+		flags |= 0x04
+		if opt.Will.Retain {
+			flags |= 0x20
+		}
+		payload = appendString(payload, opt.Will.Topic)
+		payload = appendString(payload, string(opt.Will.Payload))
+	}
+	if opt.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, opt.Username)
+		if opt.Password != "" {
+			flags |= 0x40
+			payload = appendString(payload, opt.Password)
+		}
+	}
+	body[7] = flags
+	binary.BigEndian.PutUint16(body[8:], uint16(opt.KeepAlive/time.Second))
+	return packet(connect<<4, append(body, payload...))
+}
+
+// packet returns a packet with the fixed header byte h.
+func packet(h byte, body []byte) []byte {
+	p := append([]byte{h}, remainingLength(len(body))...)
+	return append(p, body...)
+}
+
+func remainingLength(n int) (b []byte) {
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+// readPacket reads a packet and returns its type and body.
+func readPacket(r *bufio.Reader) (typ byte, body []byte, err error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mul := 0, 1
+	for i := 0; ; i++ {
+		d, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(d&0x7F) * mul
+		if d&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+		mul *= 128
+	}
+	body = make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return h >> 4, body, nil
+}
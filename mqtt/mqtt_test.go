@@ -0,0 +1,102 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRemainingLength(t *testing.T) {
+	for _, c := range []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0}},
+		{127, []byte{0x7F}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xFF, 0x7F}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+	} {
+		if got := remainingLength(c.n); !bytes.Equal(got, c.want) {
+			t.Errorf("%d: got % X, want % X", c.n, got, c.want)
+		}
+	}
+}
+
+// broker accepts one connection, answers CONNECT with return code rc and
+// passes the packets it receives on.
+func broker(t *testing.T, rc byte) (addr string, packets chan []byte) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets = make(chan []byte, 10)
+	go func() {
+		defer ln.Close()
+		defer close(packets)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			typ, body, err := readPacket(r)
+			if err != nil {
+				return
+			}
+			packets <- append([]byte{typ}, body...)
+			if typ == connect {
+				conn.Write([]byte{connack << 4, 2, 0, rc})
+			}
+		}
+	}()
+	return ln.Addr().String(), packets
+}
+
+func TestPublish(t *testing.T) {
+	addr, packets := broker(t, 0)
+	c, err := Dial(Options{
+		Addr:      addr,
+		ClientID:  "rtldavis",
+		Username:  "user",
+		Password:  "secret",
+		KeepAlive: 30 * time.Second,
+		Will:      &Message{"rtldavis/status", []byte("offline"), true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish(Message{"rtldavis/state", []byte(`{"outTemp":12.5}`), false}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]byte{
+		append([]byte{connect,
+			0, 4, 'M', 'Q', 'T', 'T', 4, 0xE6, 0, 30,
+			0, 8}, "rtldavis\x00\x0Frtldavis/status\x00\x07offline\x00\x04user\x00\x06secret"...),
+		append([]byte{publish, 0, 14}, `rtldavis/state{"outTemp":12.5}`...),
+		{disconnect},
+	}
+	for i, w := range want {
+		got := <-packets
+		if !bytes.Equal(got, w) {
+			t.Errorf("packet %d: got % X, want % X", i, got, w)
+		}
+	}
+	if err := c.Publish(Message{Topic: "x"}); err != ErrClosed {
+		t.Errorf("publish after close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestRefused(t *testing.T) {
+	addr, _ := broker(t, 4)
+	if _, err := Dial(Options{Addr: addr, ClientID: "rtldavis"}); err == nil || err.Error() != "mqtt: connection refused: bad user name or password" {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package output
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// asyncCloseWait is how long Close waits for the queued writes.
+var asyncCloseWait = 5 * time.Second
+
+// Async writes to a sink on a goroutine of its own, so a slow or
+// unreachable network service does not hold up the receiver. Writes are
+// queued and dropped while the queue is full. The error of a queued write
+// is returned by a later call.
+type Async struct {
+	s    Sink
+	q    chan func() error
+	done chan struct{}
+	stop chan struct{} // closed when Close gives up on the queue
+
+	mu      sync.Mutex
+	err     error
+	dropped int
+}
+
+// NewAsync starts writing to s with a queue of n writes.
+func NewAsync(s Sink, n int) *Async {
+	a := &Async{s: s, q: make(chan func() error, n), done: make(chan struct{}), stop: make(chan struct{})}
+	go func() {
+		defer close(a.done)
+		for f := range a.q {
+			select {
+			case <-a.stop:
+				continue // drop the rest of the queue
+			default:
+			}
+			if err := f(); err != nil {
+				a.mu.Lock()
+				a.err = err
+				a.mu.Unlock()
+			}
+		}
+	}()
+	return a
+}
+
+func (a *Async) queue(f func() error) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case a.q <- f:
+	default:
+		a.dropped++
+		return fmt.Errorf("output queue full, %d writes dropped", a.dropped)
+	}
+	err := a.err
+	a.err = nil
+	return err
+}
+
+// Observation queues writing o.
+func (a *Async) Observation(o Observation) error {
+	return a.queue(func() error { return a.s.Observation(o) })
+}
+
+// Record queues writing r.
+func (a *Async) Record(r Record) error {
+	return a.queue(func() error { return a.s.Record(r) })
+}
+
+// Packet queues writing p if the sink is a PacketSink.
+func (a *Async) Packet(p Packet) error {
+	ps, ok := a.s.(PacketSink)
+	if !ok {
+		return nil
+	}
+	return a.queue(func() error { return ps.Packet(p) })
+}
+
+// Stats queues writing st if the sink is a StatsSink.
+func (a *Async) Stats(st Stats) error {
+	ss, ok := a.s.(StatsSink)
+	if !ok {
+		return nil
+	}
+	return a.queue(func() error { return ss.Stats(st) })
+}
+
+// Event queues writing e if the sink is an EventSink.
+func (a *Async) Event(e Event) error {
+	es, ok := a.s.(EventSink)
+	if !ok {
+		return nil
+	}
+	return a.queue(func() error { return es.Event(e) })
+}
+
+// SetDevices queues announcing devs if the sink is a DeviceSink.
+func (a *Async) SetDevices(devs []MQTTDevice) error {
+	ds, ok := a.s.(DeviceSink)
+	if !ok {
+		return nil
+	}
+	return a.queue(func() error { return ds.SetDevices(devs) })
+}
+
+// Close waits for the queued writes, for at most asyncCloseWait, and closes
+// the sink. When the writes take longer the rest of the queue is dropped,
+// and the sink is left to the write in progress, so a service which does
+// not answer can not hold up the exit.
+func (a *Async) Close() error {
+	close(a.q)
+	select {
+	case <-a.done:
+	case <-time.After(asyncCloseWait):
+		n := len(a.q)
+		close(a.stop)
+		return fmt.Errorf("output not closed in %s, %d writes dropped", asyncCloseWait, n)
+	}
+	err := a.s.Close()
+	if err == nil {
+		err = a.err
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+package output
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// blocking is a sink whose writes hang until release is closed.
+type blocking struct {
+	release chan struct{}
+	closed  bool
+}
+
+func (b *blocking) Observation(o Observation) error { <-b.release; return nil }
+func (b *blocking) Record(r Record) error           { <-b.release; return nil }
+func (b *blocking) Close() error                    { b.closed = true; return nil }
+
+func TestAsyncClose(t *testing.T) {
+	defer func(d time.Duration) { asyncCloseWait = d }(asyncCloseWait)
+	asyncCloseWait = 50 * time.Millisecond
+
+	b := &blocking{release: make(chan struct{})}
+	defer close(b.release)
+	a := NewAsync(b, 10)
+	for i := 0; i < 3; i++ {
+		a.Observation(Observation{})
+	}
+	start := time.Now()
+	err := a.Close()
+	if time.Since(start) > time.Second {
+		t.Errorf("Close took %s", time.Since(start))
+	}
+	if err == nil || !strings.Contains(err.Error(), "2 writes dropped") {
+		t.Errorf("got %v", err)
+	}
+	if b.closed {
+		t.Error("sink closed during a write")
+	}
+}
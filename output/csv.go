@@ -0,0 +1,235 @@
+package output
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// DefaultCSVColumns are the columns of the readings files unless configured.
+var DefaultCSVColumns = []string{
+	"time", "id", "name", "outTemp", "outHumidity", "dewpoint", "windSpeed", "windDir",
+	"windGust", "rainRate", "dayRain", "radiation", "UV", "supercapVolt", "solarCellVolt",
+}
+
+// packetColumns are the columns of the packets files.
+var packetColumns = []string{"time", "id", "name", "data", "channel", "freq_error", "rssi"}
+
+// CSV writes the observations and the raw packets to CSV files in a
+// directory, readings-<date>.csv and packets-<date>.csv, with a new pair of
+// files every day or month. The time of a record decides its file, so at
+// midnight the old file is closed and no record is split across files. A
+// new file is created with its header in place, so a reader never sees a
+// file without one. An existing file with other columns, written before
+// they were changed, is not appended to: the records go to
+// readings-<date>.2.csv and so on instead. Archive records are not
+// written.
+type CSV struct {
+	dir      string
+	monthly  bool
+	columns  []string
+	readings csvFile
+	packets  csvFile
+}
+
+// csvFile is the current file of a series.
+type csvFile struct {
+	prefix string
+	period string // date of the open file
+	f      *os.File
+	w      *csv.Writer
+}
+
+// NewCSV returns a CSV output writing to dir. The readings files have the
+// given columns: time, id, name, type or the name of a value.
+func NewCSV(dir string, monthly bool, columns []string) (*CSV, error) {
+	if fi, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s: not a directory", dir)
+	}
+	if len(columns) == 0 {
+		columns = DefaultCSVColumns
+	}
+	return &CSV{
+		dir:      dir,
+		monthly:  monthly,
+		columns:  columns,
+		readings: csvFile{prefix: "readings"},
+		packets:  csvFile{prefix: "packets"},
+	}, nil
+}
+
+func (c *CSV) period(t time.Time) string {
+	if c.monthly {
+		return t.Format("2006-01")
+	}
+	return t.Format("2006-01-02")
+}
+
+// write appends record to the file of the period of t, switching files
+// when the period changed.
+func (c *CSV) write(cf *csvFile, t time.Time, header, record []string) error {
+	if period := c.period(t); period != cf.period || cf.f == nil {
+		if err := cf.close(); err != nil {
+			return err
+		}
+		path, err := c.path(cf.prefix, period, header)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		cf.f, cf.w, cf.period = f, csv.NewWriter(f), period
+	}
+	if err := cf.w.Write(record); err != nil {
+		return err
+	}
+	cf.w.Flush()
+	return cf.w.Error()
+}
+
+// path returns the path of the file of a period with the given header,
+// creating it when there is none.
+func (c *CSV) path(prefix, period string, header []string) (string, error) {
+	for n := 1; ; n++ {
+		name := fmt.Sprintf("%s-%s.csv", prefix, period)
+		if n > 1 {
+			name = fmt.Sprintf("%s-%s.%d.csv", prefix, period, n)
+		}
+		path := filepath.Join(c.dir, name)
+		ok, err := createWithHeader(path, header)
+		if err != nil || ok {
+			return path, err
+		}
+	}
+}
+
+// createWithHeader creates the file at path with a header line, unless it
+// exists, and tells whether the file has that header. It is written to a
+// temporary file first and renamed into place.
+func createWithHeader(path string, header []string) (ok bool, err error) {
+	if f, err := os.Open(path); err == nil {
+		defer f.Close()
+		got, err := csv.NewReader(f).Read()
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		return reflect.DeepEqual(got, header), nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, create(path, header)
+}
+
+// create writes a new file with a header line to path.
+func create(path string, header []string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(tmp)
+	w.Write(header)
+	w.Flush()
+	if err := w.Error(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (cf *csvFile) close() error {
+	if cf.f == nil {
+		return nil
+	}
+	cf.w.Flush()
+	err := cf.w.Error()
+	if e := cf.f.Close(); err == nil {
+		err = e
+	}
+	cf.f, cf.w = nil, nil
+	return err
+}
+
+func formatTime(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// csvFloat formats v with prec decimals, -1 for as many as needed. NaN and
+// infinite values, an unknown signal strength, are empty: spreadsheets
+// do not take them.
+func csvFloat(v float64, prec int) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', prec, 64)
+}
+
+// Observation appends o to the readings file. Unknown values are empty.
+func (c *CSV) Observation(o Observation) error {
+	record := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		switch col {
+		case "time":
+			record[i] = formatTime(o.Time)
+		case "id":
+			record[i] = strconv.Itoa(o.ID)
+		case "name":
+			record[i] = o.Name
+		case "type":
+			record[i] = o.Type
+		default:
+			if v, ok := o.Values[col]; ok {
+				record[i] = csvFloat(v, -1)
+			}
+		}
+	}
+	return c.write(&c.readings, o.Time, c.columns, record)
+}
+
+// Packet appends p to the packets file.
+func (c *CSV) Packet(p Packet) error {
+	record := []string{
+		formatTime(p.Time),
+		strconv.Itoa(p.ID),
+		p.Name,
+		fmt.Sprintf("%02X", p.Data),
+		strconv.Itoa(p.Channel),
+		strconv.Itoa(p.FreqError),
+		csvFloat(p.RSSI, 1),
+	}
+	return c.write(&c.packets, p.Time, packetColumns, record)
+}
+
+// Record does nothing, see CSV.
+func (c *CSV) Record(r Record) error {
+	return nil
+}
+
+// Close closes the open files.
+func (c *CSV) Close() error {
+	err := c.readings.close()
+	if e := c.packets.close(); err == nil {
+		err = e
+	}
+	return err
+}
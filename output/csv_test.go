@@ -0,0 +1,84 @@
+package output
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtldavis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	loc := time.FixedZone("CET", 3600)
+	before := time.Date(2019, 3, 24, 23, 59, 59, 0, loc)
+	after := before.Add(2 * time.Second)
+	columns := []string{"time", "name", "outTemp", "windSpeed"}
+
+	c, err := NewCSV(dir, false, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, at := range []time.Time{before, after} {
+		if err := c.Observation(Observation{at, 0, "ISS", "", map[string]float64{"outTemp": 12.5}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Packet(Packet{after, 0, "ISS", []byte{0x80, 0x1F}, 3, -1500, -21.25}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// appending to an existing file does not repeat the header
+	if c, err = NewCSV(dir, false, columns); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Observation(Observation{after, 0, "ISS", "", map[string]float64{"windSpeed": 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Packet(Packet{after, 1, "", []byte{0x81, 0x00}, 4, 0, math.Inf(-1)}); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	// other columns go to a new file
+	if c, err = NewCSV(dir, false, []string{"time", "outTemp"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Observation(Observation{after, 0, "ISS", "", map[string]float64{"outTemp": 13}}); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	for name, want := range map[string]string{
+		"readings-2019-03-24.csv": "time,name,outTemp,windSpeed\n" +
+			"2019-03-24T23:59:59.000+01:00,ISS,12.5,\n",
+		"readings-2019-03-25.csv": "time,name,outTemp,windSpeed\n" +
+			"2019-03-25T00:00:01.000+01:00,ISS,12.5,\n" +
+			"2019-03-25T00:00:01.000+01:00,ISS,,2\n",
+		"packets-2019-03-25.csv": "time,id,name,data,channel,freq_error,rssi\n" +
+			"2019-03-25T00:00:01.000+01:00,0,ISS,801F,3,-1500,-21.2\n" +
+			"2019-03-25T00:00:01.000+01:00,1,,8100,4,0,\n",
+		"readings-2019-03-25.2.csv": "time,outTemp\n" +
+			"2019-03-25T00:00:01.000+01:00,13\n",
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", name, got, want)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 4 {
+		t.Errorf("got files %s", files)
+	}
+}
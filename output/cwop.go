@@ -0,0 +1,164 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+// CWOPOptions are the options of the CWOP output.
+type CWOPOptions struct {
+	Call     string // callsign or CWOP id, e.g. EW1234
+	Passcode string // APRS-IS passcode, -1 for CWOP ids
+	Server   string // APRS-IS host:port
+	Interval time.Duration
+	Lat, Lon float64 // degrees
+	Software string  // appended to the reports, e.g. rtldavis
+}
+
+// CWOP submits the current conditions as APRS weather reports to the
+// Citizen Weather Observer Program over APRS-IS, at most every interval.
+// Each report gets a connection of its own, as CWOP recommends.
+type CWOP struct {
+	opt  CWOPOptions
+	last time.Time
+}
+
+// NewCWOP returns a CWOP output.
+func NewCWOP(opt CWOPOptions) *CWOP {
+	return &CWOP{opt: opt}
+}
+
+const (
+	msToMph  = 1 / 0.44704
+	mmToInch = 1 / 25.4
+)
+
+// aprsField formats v as a field of width digits, with dots when it is
+// unknown.
+func aprsField(tag string, v float64, ok bool, width int) string {
+	if !ok || math.IsNaN(v) {
+		return tag + strings.Repeat(".", width)
+	}
+	n := int(math.Floor(v + 0.5))
+	if n < 0 {
+		return fmt.Sprintf("%s-%0*d", tag, width-1, -n)
+	}
+	return fmt.Sprintf("%s%0*d", tag, width, n)
+}
+
+// aprsPosition formats a position as ddmm.mmN/dddmm.mmE.
+func aprsPosition(lat, lon float64) string {
+	ns, ew := "N", "E"
+	if lat < 0 {
+		ns, lat = "S", -lat
+	}
+	if lon < 0 {
+		ew, lon = "W", -lon
+	}
+	// hundredths of minutes, rounded, so 59.999' does not become 60.00'
+	latH := int(math.Floor(lat*6000 + 0.5))
+	lonH := int(math.Floor(lon*6000 + 0.5))
+	return fmt.Sprintf("%02d%05.2f%s/%03d%05.2f%s",
+		latH/6000, float64(latH%6000)/100, ns, lonH/6000, float64(lonH%6000)/100, ew)
+}
+
+// aprsWeather formats the APRS weather report of the values of o.
+func (c *CWOP) aprsWeather(o Observation) string {
+	v := func(name string) (float64, bool) {
+		x, ok := o.Values[name]
+		return x, ok
+	}
+	// prefer the averages a console would report
+	first := func(names ...string) (float64, bool) {
+		for _, n := range names {
+			if x, ok := v(n); ok {
+				return x, true
+			}
+		}
+		return 0, false
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s>APRS,TCPIP*:@%sz%s_", c.opt.Call, o.Time.UTC().Format("021504"), aprsPosition(c.opt.Lat, c.opt.Lon))
+	dir, ok := first("windDir2", "windDir")
+	b.WriteString(aprsField("", dir, ok, 3))
+	speed, ok := first("windSpeed2", "windSpeed")
+	b.WriteString(aprsField("/", speed*msToMph, ok, 3))
+	gust, ok := first("windGust5", "windGust")
+	b.WriteString(aprsField("g", gust*msToMph, ok, 3))
+	temp, ok := v("outTemp")
+	b.WriteString(aprsField("t", temp*9/5+32, ok, 3))
+	for _, f := range []struct{ tag, name string }{{"r", "hourRain"}, {"p", "rain24"}, {"P", "dayRain"}} {
+		rain, ok := v(f.name)
+		b.WriteString(aprsField(f.tag, rain*mmToInch*100, ok, 3))
+	}
+	if hum, ok := v("outHumidity"); ok {
+		h := int(math.Floor(hum + 0.5))
+		if h >= 100 {
+			h = 0 // 00 is 100%
+		}
+		fmt.Fprintf(&b, "h%02d", h)
+	}
+	if rad, ok := v("radiation"); ok {
+		if r := int(math.Floor(rad + 0.5)); r < 1000 {
+			fmt.Fprintf(&b, "L%03d", r)
+		} else {
+			fmt.Fprintf(&b, "l%03d", r-1000)
+		}
+	}
+	b.WriteString(c.opt.Software)
+	return b.String()
+}
+
+// Observation submits a report of o when the interval has passed since
+// the last one.
+func (c *CWOP) Observation(o Observation) error {
+	if o.Time.Sub(c.last) < c.opt.Interval {
+		return nil
+	}
+	c.last = o.Time
+	return c.submit(c.aprsWeather(o))
+}
+
+// submit logs in to APRS-IS and sends report.
+func (c *CWOP) submit(report string) error {
+	conn, err := net.DialTimeout("tcp", c.opt.Server, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("cwop %s: %s", c.opt.Server, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	r := bufio.NewReader(conn)
+	// the server greets with a comment line
+	if _, err := r.ReadString('\n'); err != nil {
+		return fmt.Errorf("cwop %s: %s", c.opt.Server, err)
+	}
+	if _, err := fmt.Fprintf(conn, "user %s pass %s vers %s\r\n", c.opt.Call, c.opt.Passcode, c.opt.Software); err != nil {
+		return fmt.Errorf("cwop %s: %s", c.opt.Server, err)
+	}
+	resp, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("cwop %s: %s", c.opt.Server, err)
+	}
+	if !strings.HasPrefix(resp, "# logresp") {
+		return fmt.Errorf("cwop %s: unexpected login response %q", c.opt.Server, strings.TrimSpace(resp))
+	}
+	if _, err := fmt.Fprintf(conn, "%s\r\n", report); err != nil {
+		return fmt.Errorf("cwop %s: %s", c.opt.Server, err)
+	}
+	return nil
+}
+
+// Record does nothing; reports are made of the current conditions.
+func (c *CWOP) Record(r Record) error {
+	return nil
+}
+
+// Close does nothing.
+func (c *CWOP) Close() error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package output
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPRSWeather(t *testing.T) {
+	c := NewCWOP(CWOPOptions{Call: "EW1234", Lat: 49.0583333, Lon: -72.0291667, Software: "rtldavis"})
+	at := time.Date(2019, 3, 9, 23, 45, 10, 0, time.UTC)
+	o := Observation{Time: at, Values: map[string]float64{
+		"windDir2":    220,
+		"windSpeed2":  2.2352, // 5 mph
+		"windGust5":   4.4704, // 10 mph
+		"outTemp":     -20.5,  // -4.9 F
+		"hourRain":    0.254,  // 0.01 in
+		"rain24":      2.54,   // 0.10 in
+		"outHumidity": 100,
+		"radiation":   1024,
+	}}
+	want := "EW1234>APRS,TCPIP*:@092345z4903.50N/07201.75W_220/005g010t-05r001p010P...h00l024rtldavis"
+	if got := c.aprsWeather(o); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	// without wind
+	o = Observation{Time: at, Values: map[string]float64{"outTemp": 20}}
+	want = "EW1234>APRS,TCPIP*:@092345z4903.50N/07201.75W_.../...g...t068r...p...P...rtldavis"
+	if got := c.aprsWeather(o); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestCWOPSubmit(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				close(lines)
+				return
+			}
+			conn.Write([]byte("# aprsc 2.1.4\r\n"))
+			r := bufio.NewReader(conn)
+			login, _ := r.ReadString('\n')
+			lines <- strings.TrimSpace(login)
+			conn.Write([]byte("# logresp EW1234 unverified, server T2TEST\r\n"))
+			report, _ := r.ReadString('\n')
+			lines <- strings.TrimSpace(report)
+			conn.Close()
+		}
+	}()
+
+	c := NewCWOP(CWOPOptions{Call: "EW1234", Passcode: "-1", Server: ln.Addr().String(),
+		Interval: 5 * time.Minute, Software: "rtldavis"})
+	at := time.Now()
+	for _, d := range []time.Duration{0, time.Minute, 5 * time.Minute} {
+		if err := c.Observation(Observation{Time: at.Add(d), Values: map[string]float64{"outTemp": 20}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := <-lines; got != "user EW1234 pass -1 vers rtldavis" {
+		t.Errorf("login: got %q", got)
+	}
+	if got := <-lines; !strings.HasPrefix(got, "EW1234>APRS,TCPIP*:@") || !strings.Contains(got, "t068") {
+		t.Errorf("report: got %q", got)
+	}
+	// the report a minute later is skipped, the one after 5 minutes sent
+	<-lines
+	if got := <-lines; !strings.HasPrefix(got, "EW1234>APRS") {
+		t.Errorf("second report: got %q", got)
+	}
+	select {
+	case l := <-lines:
+		t.Errorf("unexpected %q", l)
+	default:
+	}
+}
@@ -0,0 +1,147 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"mqtt"
+)
+
+// hassSensor describes a Home Assistant entity of a transmitter.
+type hassSensor struct {
+	key         string // value name in the state topic
+	name        string
+	component   string // sensor or binary_sensor
+	unit        string
+	deviceClass string
+	stateClass  string
+	icon        string
+	diagnostic  bool
+	perTr       bool // in the transmitter state topic instead of the station's
+}
+
+var (
+	hassOutTemp     = hassSensor{key: "outTemp", name: "Temperature", unit: "°C", deviceClass: "temperature", stateClass: "measurement"}
+	hassOutHumidity = hassSensor{key: "outHumidity", name: "Humidity", unit: "%", deviceClass: "humidity", stateClass: "measurement"}
+	hassDewpoint    = hassSensor{key: "dewpoint", name: "Dew point", unit: "°C", deviceClass: "temperature", stateClass: "measurement"}
+	hassWindSpeed   = hassSensor{key: "windSpeed", name: "Wind speed", unit: "m/s", deviceClass: "wind_speed", stateClass: "measurement"}
+	hassWindDir     = hassSensor{key: "windDir", name: "Wind direction", unit: "°", stateClass: "measurement", icon: "mdi:compass-outline"}
+	hassWindGust    = hassSensor{key: "windGust", name: "Wind gust", unit: "m/s", deviceClass: "wind_speed", stateClass: "measurement"}
+	hassRainRate    = hassSensor{key: "rainRate", name: "Rain rate", unit: "mm/h", deviceClass: "precipitation_intensity", stateClass: "measurement"}
+	hassDayRain     = hassSensor{key: "dayRain", name: "Rain today", unit: "mm", deviceClass: "precipitation", stateClass: "total_increasing"}
+	hassRadiation   = hassSensor{key: "radiation", name: "Solar radiation", unit: "W/m²", deviceClass: "irradiance", stateClass: "measurement"}
+	hassUV          = hassSensor{key: "UV", name: "UV index", unit: "UV index", stateClass: "measurement", icon: "mdi:sun-wireless"}
+
+	// of every transmitter
+	hassBattery     = hassSensor{key: "battery_low", name: "Battery", component: "binary_sensor", deviceClass: "battery", diagnostic: true, perTr: true}
+	hassLinkQuality = hassSensor{key: "link_quality", name: "Link quality", unit: "%", stateClass: "measurement", icon: "mdi:signal", diagnostic: true, perTr: true}
+)
+
+// hassSensors are the entities by transmitter type.
+var hassSensors = map[string][]hassSensor{
+	"auto":       {hassOutTemp, hassOutHumidity, hassDewpoint, hassWindSpeed, hassWindDir, hassWindGust, hassRainRate, hassDayRain, hassRadiation, hassUV},
+	"iss":        {hassOutTemp, hassOutHumidity, hassDewpoint, hassWindSpeed, hassWindDir, hassWindGust, hassRainRate, hassDayRain, hassRadiation, hassUV},
+	"vue":        {hassOutTemp, hassOutHumidity, hassDewpoint, hassWindSpeed, hassWindDir, hassWindGust, hassRainRate, hassDayRain},
+	"anemometer": {hassWindSpeed, hassWindDir, hassWindGust},
+	"leafsoil":   hassProbes(),
+}
+
+// hassWind are the keys of the wind entities, which an ISS does not have
+// when its wind comes from an anemometer transmitter kit.
+var hassWind = map[string]bool{hassWindSpeed.key: true, hassWindDir.key: true, hassWindGust.key: true}
+
+// hassProbes returns the entities of the four soil and the four leaf
+// probes a leaf & soil station can have. Those without a probe stay
+// unknown.
+func hassProbes() (sensors []hassSensor) {
+	for port := 1; port <= 4; port++ {
+		sensors = append(sensors,
+			hassSensor{key: fmt.Sprintf("soilTemp%d", port), name: fmt.Sprintf("Soil temperature %d", port), unit: "°C", deviceClass: "temperature", stateClass: "measurement"},
+			hassSensor{key: fmt.Sprintf("soilMoist%d", port), name: fmt.Sprintf("Soil moisture %d", port), unit: "cbar", stateClass: "measurement", icon: "mdi:water-percent"})
+	}
+	for port := 1; port <= 4; port++ {
+		sensors = append(sensors,
+			hassSensor{key: fmt.Sprintf("leafTemp%d", port), name: fmt.Sprintf("Leaf temperature %d", port), unit: "°C", deviceClass: "temperature", stateClass: "measurement"},
+			hassSensor{key: fmt.Sprintf("leafWet%d", port), name: fmt.Sprintf("Leaf wetness %d", port), stateClass: "measurement", icon: "mdi:leaf"})
+	}
+	return sensors
+}
+
+// hassModels are the device models by transmitter type.
+var hassModels = map[string]string{
+	"auto":       "Vantage Pro2 or Vue ISS",
+	"iss":        "Vantage Pro2 ISS",
+	"vue":        "Vantage Vue ISS",
+	"temphum":    "Temperature/humidity station",
+	"leafsoil":   "Leaf/soil moisture station",
+	"anemometer": "Anemometer transmitter kit",
+}
+
+// hassDiscovery returns the retained discovery messages announcing the
+// entities of a transmitter under prefix, the Home Assistant discovery
+// prefix. topic is the prefix of the MQTT output's own topics.
+func hassDiscovery(prefix, topic string, d MQTTDevice) (msgs []mqtt.Message) {
+	node := fmt.Sprintf("rtldavis_%d", d.ID)
+	device := map[string]interface{}{
+		"identifiers":  []string{node},
+		"name":         d.Name,
+		"manufacturer": "Davis Instruments",
+		"model":        hassModels[d.Type],
+	}
+	var sensors []hassSensor
+	for _, s := range hassSensors[d.Type] {
+		if d.NoWind && hassWind[s.key] {
+			continue
+		}
+		sensors = append(sensors, s)
+	}
+	if d.Type == "temphum" {
+		// extra sensors are numbered by Davis ID
+		sensors = append(sensors,
+			hassSensor{key: fmt.Sprintf("extraTemp%d", d.ID+1), name: "Temperature", unit: "°C", deviceClass: "temperature", stateClass: "measurement"},
+			hassSensor{key: fmt.Sprintf("extraHumid%d", d.ID+1), name: "Humidity", unit: "%", deviceClass: "humidity", stateClass: "measurement"})
+	}
+	sensors = append(sensors, hassBattery, hassLinkQuality)
+	for _, s := range sensors {
+		component := s.component
+		if component == "" {
+			component = "sensor"
+		}
+		stateTopic := topic + "/state"
+		if s.perTr {
+			stateTopic = fmt.Sprintf("%s/%d/state", topic, d.ID)
+		}
+		cfg := map[string]interface{}{
+			"name":               s.name,
+			"unique_id":          node + "_" + s.key,
+			"object_id":          node + "_" + s.key,
+			"state_topic":        stateTopic,
+			"value_template":     fmt.Sprintf("{{ value_json.%s }}", s.key),
+			"availability_topic": topic + "/status",
+			"device":             device,
+		}
+		if component == "binary_sensor" {
+			cfg["value_template"] = fmt.Sprintf("{{ 'ON' if value_json.%s else 'OFF' }}", s.key)
+		}
+		for k, v := range map[string]string{
+			"unit_of_measurement": s.unit,
+			"device_class":        s.deviceClass,
+			"state_class":         s.stateClass,
+			"icon":                s.icon,
+		} {
+			if v != "" {
+				cfg[k] = v
+			}
+		}
+		if s.diagnostic {
+			cfg["entity_category"] = "diagnostic"
+		}
+		payload, _ := json.Marshal(cfg)
+		msgs = append(msgs, mqtt.Message{
+			Topic:   fmt.Sprintf("%s/%s/%s/%s/config", prefix, component, node, s.key),
+			Payload: payload,
+			Retain:  true,
+		})
+	}
+	return msgs
+}
@@ -0,0 +1,79 @@
+package output
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestHassDiscovery(t *testing.T) {
+	msgs := hassDiscovery("homeassistant", "rtldavis", MQTTDevice{ID: 1, Name: "Back yard", Type: "vue"})
+	if len(msgs) != 10 {
+		t.Fatalf("got %d messages, want 8 sensors, battery and link quality", len(msgs))
+	}
+	byTopic := make(map[string]map[string]interface{})
+	for _, m := range msgs {
+		if !m.Retain {
+			t.Errorf("%s not retained", m.Topic)
+		}
+		var cfg map[string]interface{}
+		if err := json.Unmarshal(m.Payload, &cfg); err != nil {
+			t.Fatalf("%s: %s", m.Topic, err)
+		}
+		byTopic[m.Topic] = cfg
+	}
+
+	temp := byTopic["homeassistant/sensor/rtldavis_1/outTemp/config"]
+	if temp == nil {
+		t.Fatalf("no temperature sensor in %v", byTopic)
+	}
+	for k, want := range map[string]string{
+		"unique_id":           "rtldavis_1_outTemp",
+		"state_topic":         "rtldavis/state",
+		"value_template":      "{{ value_json.outTemp }}",
+		"unit_of_measurement": "°C",
+		"device_class":        "temperature",
+		"availability_topic":  "rtldavis/status",
+	} {
+		if temp[k] != want {
+			t.Errorf("temperature %s: got %v, want %q", k, temp[k], want)
+		}
+	}
+	dev, _ := temp["device"].(map[string]interface{})
+	if dev["name"] != "Back yard" || dev["model"] != "Vantage Vue ISS" {
+		t.Errorf("device: got %v", dev)
+	}
+
+	batt := byTopic["homeassistant/binary_sensor/rtldavis_1/battery_low/config"]
+	if batt == nil || batt["state_topic"] != "rtldavis/1/state" || batt["entity_category"] != "diagnostic" {
+		t.Errorf("battery: got %v", batt)
+	}
+	if _, ok := byTopic["homeassistant/sensor/rtldavis_1/UV/config"]; ok {
+		t.Error("a Vue has no UV sensor")
+	}
+}
+
+func TestHassDiscoveryTempHum(t *testing.T) {
+	msgs := hassDiscovery("homeassistant", "rtldavis", MQTTDevice{ID: 2, Name: "Garden", Type: "temphum"})
+	var cfg map[string]interface{}
+	for _, m := range msgs {
+		if m.Topic == "homeassistant/sensor/rtldavis_2/extraTemp3/config" {
+			json.Unmarshal(m.Payload, &cfg)
+		}
+	}
+	if cfg["value_template"] != "{{ value_json.extraTemp3 }}" || cfg["state_topic"] != "rtldavis/state" {
+		t.Errorf("got %v", cfg)
+	}
+}
+
+func TestHassDiscoveryNoWind(t *testing.T) {
+	msgs := hassDiscovery("homeassistant", "rtldavis", MQTTDevice{ID: 0, Name: "ISS", Type: "iss", NoWind: true})
+	if len(msgs) != 9 {
+		t.Errorf("got %d messages, want 7 sensors, battery and link quality", len(msgs))
+	}
+	for _, m := range msgs {
+		if strings.Contains(m.Topic, "/wind") {
+			t.Errorf("wind entity %s of an ISS without wind", m.Topic)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Influx writes InfluxDB line protocol:
+//
+//	weather,id=0,name=ISS,type=iss outTemp=12.5 <ns>         observations
+//	archive interval=300i,outTemp=12.4,rain=0.2 <ns>         archive records
+//	reception,id=0,name=ISS percent=98.5 <ns>                with each record
+//	receiver inits=0i <ns>                                   statistics
+//	receiver,id=0,name=ISS received=812i,missed=3i,skipped=0i,freq_error=-1500i,rssi=-21.3 <ns>
+type Influx struct {
+	write func([]byte) error
+	c     io.Closer
+}
+
+// NewInflux opens an InfluxDB line protocol output. target is "-" for
+// stdout, udp://host:port, an http:// or https:// write endpoint such as
+// http://localhost:8086/write?db=weather, or else a file to append to.
+func NewInflux(target string) (*Influx, error) {
+	switch {
+	case target == "-":
+		return &Influx{write: writeTo(os.Stdout)}, nil
+	case strings.HasPrefix(target, "udp://"):
+		conn, err := net.Dial("udp", strings.TrimPrefix(target, "udp://"))
+		if err != nil {
+			return nil, err
+		}
+		return &Influx{write: writeTo(conn), c: conn}, nil
+	case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"):
+		client := &http.Client{Timeout: 10 * time.Second}
+		return &Influx{write: func(data []byte) error {
+			return postLines(client, target, data)
+		}}, nil
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Influx{write: writeTo(f), c: f}, nil
+}
+
+func writeTo(w io.Writer) func([]byte) error {
+	return func(data []byte) error {
+		_, err := w.Write(data)
+		return err
+	}
+}
+
+func postLines(client *http.Client, url string, data []byte) error {
+	resp, err := client.Post(url, "text/plain; charset=utf-8", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("influx %s: %s %s", url, resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// escape escapes a measurement, tag key, tag value or field key.
+var escape = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace
+
+// line appends a line of measurement m with the tags and fields, which are
+// written in the order of their names.
+func line(buf *bytes.Buffer, m string, tags map[string]string, fields map[string]string, t time.Time) {
+	if len(fields) == 0 {
+		return
+	}
+	buf.WriteString(escape(m))
+	for _, k := range sortedKeys(tags) {
+		if tags[k] != "" {
+			fmt.Fprintf(buf, ",%s=%s", escape(k), escape(tags[k]))
+		}
+	}
+	for i, k := range sortedKeys(fields) {
+		sep := ","
+		if i == 0 {
+			sep = " "
+		}
+		fmt.Fprintf(buf, "%s%s=%s", sep, escape(k), fields[k])
+	}
+	fmt.Fprintf(buf, " %d\n", t.UnixNano())
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func float(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func integer(v int) string {
+	return strconv.Itoa(v) + "i"
+}
+
+// finite reports whether v can be written; line protocol has no NaN or Inf.
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func floats(values map[string]float64) map[string]string {
+	fields := make(map[string]string, len(values))
+	for k, v := range values {
+		if finite(v) {
+			fields[k] = float(v)
+		}
+	}
+	return fields
+}
+
+func idTags(id int, name string) map[string]string {
+	return map[string]string{"id": strconv.Itoa(id), "name": name}
+}
+
+// send writes the lines in data, if any.
+func (x *Influx) send(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return x.write(data)
+}
+
+// Observation writes o to the weather measurement.
+func (x *Influx) Observation(o Observation) error {
+	var buf bytes.Buffer
+	tags := idTags(o.ID, o.Name)
+	tags["type"] = o.Type
+	line(&buf, "weather", tags, floats(o.Values), o.Time)
+	return x.send(buf.Bytes())
+}
+
+// Record writes r to the archive measurement and its reception to the
+// reception measurement.
+func (x *Influx) Record(r Record) error {
+	var buf bytes.Buffer
+	fields := floats(r.Values)
+	fields["interval"] = integer(int(r.Interval / time.Second))
+	line(&buf, "archive", nil, fields, r.Time)
+	for _, rx := range r.Reception {
+		line(&buf, "reception", idTags(rx.ID, rx.Name), map[string]string{"percent": float(rx.Percent)}, r.Time)
+	}
+	return x.send(buf.Bytes())
+}
+
+// Stats writes st to the receiver measurement.
+func (x *Influx) Stats(st Stats) error {
+	var buf bytes.Buffer
+	line(&buf, "receiver", nil, map[string]string{"inits": integer(st.Inits)}, st.Time)
+	for _, tr := range st.Transmitters {
+		fields := map[string]string{
+			"received":    integer(tr.Received),
+			"missed":      integer(tr.Missed),
+			"skipped":     integer(tr.Skipped),
+			"freq_error":  integer(tr.FreqError),
+			"battery_low": strconv.FormatBool(tr.BatteryLow),
+		}
+		for k, v := range map[string]float64{"rssi": tr.RSSI, "supercap": tr.Supercap, "solar_cell": tr.SolarCell} {
+			if finite(v) {
+				fields[k] = float(v)
+			}
+		}
+		line(&buf, "receiver", idTags(tr.ID, tr.Name), fields, st.Time)
+	}
+	return x.send(buf.Bytes())
+}
+
+// Close closes the output.
+func (x *Influx) Close() error {
+	if x.c != nil {
+		return x.c.Close()
+	}
+	return nil
+}
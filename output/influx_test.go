@@ -0,0 +1,64 @@
+package output
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInflux(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got = append(got, r.URL.RawQuery, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	x, err := NewInflux(srv.URL + "/write?db=weather")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Unix(1553428800, 500)
+	if err := x.Observation(Observation{at, 1, "Back yard", "iss", map[string]float64{"outTemp": 12.5, "windSpeed": 2, "bad": math.NaN()}}); err != nil {
+		t.Fatal(err)
+	}
+	st := Stats{at, 2, []TransmitterStats{{0, "ISS", 812, 3, 1, -1500, math.Inf(-1), false, 3.05, math.NaN()}}}
+	if err := x.Stats(st); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"db=weather",
+		"weather,id=1,name=Back\\ yard,type=iss outTemp=12.5,windSpeed=2 1553428800000000500\n",
+		"db=weather",
+		"receiver inits=2i 1553428800000000500\n" +
+			"receiver,id=0,name=ISS battery_low=false,freq_error=-1500i,missed=3i,received=812i,skipped=1i,supercap=3.05 1553428800000000500\n",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %q", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %q, want %q", got[i], want[i])
+		}
+	}
+}
+
+func TestInfluxError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	x, _ := NewInflux(srv.URL + "/write?db=nope")
+	if err := x.Observation(Observation{time.Now(), 0, "", "", map[string]float64{"outTemp": 1}}); err == nil {
+		t.Error("no error for status 404")
+	}
+}
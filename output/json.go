@@ -0,0 +1,114 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// JSON writes one JSON object per line.
+type JSON struct {
+	w *bufio.Writer
+	c io.Closer
+}
+
+// NewJSON opens a JSON output appending to the file at path, or writing to
+// stdout for "-".
+func NewJSON(path string) (*JSON, error) {
+	if path == "-" {
+		return &JSON{w: bufio.NewWriter(os.Stdout)}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSON{w: bufio.NewWriter(f), c: f}, nil
+}
+
+// Observation writes o as
+// {"type":"loop", "time":..., "id":..., "name":..., "station_type":...,
+// <values>}.
+func (j *JSON) Observation(o Observation) error {
+	m := map[string]interface{}{
+		"type": "loop",
+		"time": o.Time.Format(time.RFC3339Nano),
+		"id":   o.ID,
+		"name": o.Name,
+	}
+	if o.Type != "" {
+		m["station_type"] = o.Type
+	}
+	for k, v := range o.Values {
+		m[k] = v
+	}
+	return j.write(m)
+}
+
+// jsonReception is the JSON form of a Reception.
+type jsonReception struct {
+	ID      int     `json:"id"`
+	Name    string  `json:"name"`
+	Percent float64 `json:"percent"`
+}
+
+// Record writes r as {"type":"archive", "time":..., "interval":<seconds>,
+// "reception":[{"id":..., "name":..., "percent":...}, ...], <values>}.
+func (j *JSON) Record(r Record) error {
+	rx := make([]jsonReception, len(r.Reception))
+	for i, x := range r.Reception {
+		rx[i] = jsonReception(x)
+	}
+	m := map[string]interface{}{
+		"type":      "archive",
+		"time":      r.Time.Format(time.RFC3339Nano),
+		"interval":  r.Interval.Seconds(),
+		"reception": rx,
+	}
+	for k, v := range r.Values {
+		m[k] = v
+	}
+	return j.write(m)
+}
+
+// Event writes e as {"type":"event", "time":..., "id":..., "name":...,
+// "event":..., "message":..., "value":...}, the value only when it has one.
+func (j *JSON) Event(e Event) error {
+	m := map[string]interface{}{
+		"type":    "event",
+		"time":    e.Time.Format(time.RFC3339Nano),
+		"id":      e.ID,
+		"name":    e.Name,
+		"event":   e.Type,
+		"message": e.Message,
+	}
+	if finite(e.Value) {
+		m["value"] = e.Value
+	}
+	return j.write(m)
+}
+
+func (j *JSON) write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := j.w.Write(data); err != nil {
+		return err
+	}
+	// Readers tail the output, so don't keep records in the buffer.
+	return j.w.Flush()
+}
+
+// Close flushes and closes the output.
+func (j *JSON) Close() error {
+	err := j.w.Flush()
+	if j.c != nil {
+		if e := j.c.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package output
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtldavis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.json")
+
+	j, err := NewJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2019, 3, 24, 12, 0, 0, 0, time.UTC)
+	if err := j.Observation(Observation{at, 0, "ISS", "", map[string]float64{"outTemp": 12.5}}); err != nil {
+		t.Fatal(err)
+	}
+	rec := Record{at.Add(time.Minute), 5 * time.Minute, map[string]float64{"rain": 0.2}, []Reception{{0, "ISS", 95}}}
+	if err := j.Record(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), data)
+	}
+	var loop, archive map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &loop); err != nil {
+		t.Fatalf("%s: %s", lines[0], err)
+	}
+	if loop["type"] != "loop" || loop["time"] != "2019-03-24T12:00:00Z" || loop["name"] != "ISS" || loop["id"] != 0.0 || loop["outTemp"] != 12.5 {
+		t.Errorf("got %s", lines[0])
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &archive); err != nil {
+		t.Fatalf("%s: %s", lines[1], err)
+	}
+	rx, _ := archive["reception"].([]interface{})
+	if archive["type"] != "archive" || archive["interval"] != 300.0 || archive["rain"] != 0.2 || len(rx) != 1 {
+		t.Errorf("got %s", lines[1])
+	}
+}
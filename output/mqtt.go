@@ -0,0 +1,208 @@
+package output
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"mqtt"
+)
+
+// mqttRetry is how long the MQTT output waits before it connects again
+// after a failure.
+const mqttRetry = 30 * time.Second
+
+// MQTTDevice is a transmitter as announced to Home Assistant.
+type MQTTDevice struct {
+	ID     int
+	Name   string
+	Type   string // config.Type*
+	NoWind bool   // the wind comes from an anemometer transmitter kit
+}
+
+// MQTTOptions are the options of the MQTT output.
+type MQTTOptions struct {
+	mqtt.Options
+	Topic string // prefix of the topics, e.g. rtldavis
+
+	// Discovery is the Home Assistant discovery prefix, e.g.
+	// homeassistant; empty for no discovery.
+	Discovery string
+	Devices   []MQTTDevice
+}
+
+// MQTT publishes to an MQTT broker:
+//
+//	<topic>/status       online or offline, retained
+//	<topic>/state        the current conditions as JSON
+//	<topic>/<id>/state   battery and reception of a transmitter as JSON
+//	<topic>/<id>/event   health events of a transmitter as JSON
+//	<topic>/archive      archive records as JSON
+//
+// With discovery the entities of the transmitters are announced to Home
+// Assistant whenever the connection is made. A lost connection is made
+// again on the next write, at most every 30 seconds.
+type MQTT struct {
+	opt      MQTTOptions
+	c        *mqtt.Client
+	lastDial time.Time
+}
+
+// NewMQTT returns an MQTT output. It connects on the first write.
+func NewMQTT(opt MQTTOptions) *MQTT {
+	if opt.Topic == "" {
+		opt.Topic = "rtldavis"
+	}
+	opt.Will = &mqtt.Message{Topic: opt.Topic + "/status", Payload: []byte("offline"), Retain: true}
+	return &MQTT{opt: opt}
+}
+
+var errMQTTWait = errors.New("mqtt: not connected, waiting to connect again")
+
+// client returns the connection, connecting when needed.
+func (m *MQTT) client() (*mqtt.Client, error) {
+	if m.c != nil && m.c.Err() == nil {
+		return m.c, nil
+	}
+	if time.Since(m.lastDial) < mqttRetry {
+		return nil, errMQTTWait
+	}
+	m.lastDial = time.Now()
+	c, err := mqtt.Dial(m.opt.Options)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt %s: %s", m.opt.Addr, err)
+	}
+	msgs := []mqtt.Message{{Topic: m.opt.Topic + "/status", Payload: []byte("online"), Retain: true}}
+	msgs = append(msgs, m.discovery(m.opt.Devices)...)
+	for _, msg := range msgs {
+		if err := c.Publish(msg); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	m.c = c
+	return c, nil
+}
+
+// discovery returns the discovery messages of devs, none without discovery.
+func (m *MQTT) discovery(devs []MQTTDevice) (msgs []mqtt.Message) {
+	if m.opt.Discovery == "" {
+		return nil
+	}
+	for _, d := range devs {
+		msgs = append(msgs, hassDiscovery(m.opt.Discovery, m.opt.Topic, d)...)
+	}
+	return msgs
+}
+
+// SetDevices announces devs, after the transmitters were reconfigured. The
+// entities no longer announced are removed from Home Assistant with an
+// empty discovery message. Without a connection they are announced when it
+// is made.
+func (m *MQTT) SetDevices(devs []MQTTDevice) error {
+	if reflect.DeepEqual(devs, m.opt.Devices) {
+		return nil
+	}
+	old := m.discovery(m.opt.Devices)
+	m.opt.Devices = devs
+	if m.opt.Discovery == "" || m.c == nil || m.c.Err() != nil {
+		return nil
+	}
+	msgs := m.discovery(devs)
+	kept := make(map[string]bool)
+	for _, msg := range msgs {
+		kept[msg.Topic] = true
+	}
+	for _, msg := range old {
+		if !kept[msg.Topic] {
+			msgs = append(msgs, mqtt.Message{Topic: msg.Topic, Retain: true})
+		}
+	}
+	for _, msg := range msgs {
+		if err := m.c.Publish(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MQTT) publish(topic string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c, err := m.client()
+	if err != nil {
+		return err
+	}
+	return c.Publish(mqtt.Message{Topic: topic, Payload: payload})
+}
+
+// Observation publishes the values of o with its time in Unix seconds.
+func (m *MQTT) Observation(o Observation) error {
+	v := map[string]interface{}{"dateTime": o.Time.Unix()}
+	for k, x := range o.Values {
+		v[k] = x
+	}
+	return m.publish(m.opt.Topic+"/state", v)
+}
+
+// Stats publishes the battery and the link quality, the percentage of the
+// packets received since startup, of every transmitter.
+func (m *MQTT) Stats(st Stats) error {
+	for _, tr := range st.Transmitters {
+		v := map[string]interface{}{
+			"battery_low": tr.BatteryLow,
+			"received":    tr.Received,
+			"missed":      tr.Missed,
+		}
+		if n := tr.Received + tr.Missed; n > 0 {
+			v["link_quality"] = 100 * float64(tr.Received) / float64(n)
+		}
+		for k, x := range map[string]float64{"rssi": tr.RSSI, "supercap": tr.Supercap, "solar_cell": tr.SolarCell} {
+			if finite(x) {
+				v[k] = x
+			}
+		}
+		if err := m.publish(fmt.Sprintf("%s/%d/state", m.opt.Topic, tr.ID), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Event publishes e to the event topic of its transmitter.
+func (m *MQTT) Event(e Event) error {
+	v := map[string]interface{}{
+		"dateTime": e.Time.Unix(),
+		"event":    e.Type,
+		"message":  e.Message,
+	}
+	if finite(e.Value) {
+		v["value"] = e.Value
+	}
+	return m.publish(fmt.Sprintf("%s/%d/event", m.opt.Topic, e.ID), v)
+}
+
+// Record publishes r.
+func (m *MQTT) Record(r Record) error {
+	v := map[string]interface{}{
+		"dateTime": r.Time.Unix(),
+		"interval": int(r.Interval / time.Minute),
+	}
+	for k, x := range r.Values {
+		v[k] = x
+	}
+	return m.publish(m.opt.Topic+"/archive", v)
+}
+
+// Close publishes offline and disconnects.
+func (m *MQTT) Close() error {
+	if m.c == nil || m.c.Err() != nil {
+		return nil
+	}
+	m.c.Publish(mqtt.Message{Topic: m.opt.Topic + "/status", Payload: []byte("offline"), Retain: true})
+	return m.c.Close()
+}
@@ -0,0 +1,197 @@
+// Package output writes what the receiver produces to files and services.
+package output
+
+import (
+	"time"
+)
+
+// Observation is a set of named values at one time. Values use the weewx
+// names and metric units, see weather.Conditions.
+type Observation struct {
+	Time   time.Time
+	ID     int    // transmitter of the packet which triggered the observation
+	Name   string // name of that transmitter
+	Type   string // station type of that transmitter, config.Type*
+	Values map[string]float64
+}
+
+// Packet is a received packet of a defined transmitter.
+type Packet struct {
+	Time      time.Time
+	ID        int
+	Name      string
+	Data      []byte
+	Channel   int     // channel (frequency index) it was received on
+	FreqError int     // Hz
+	RSSI      float64 // dBFS
+}
+
+// Reception is how many of the packets of a transmitter were received
+// during an archive interval.
+type Reception struct {
+	ID      int
+	Name    string
+	Percent float64
+}
+
+// Record is an archive record summarizing an interval ending at Time.
+type Record struct {
+	Time      time.Time
+	Interval  time.Duration
+	Values    map[string]float64 // weewx archive field names
+	Reception []Reception        // of the configured transmitters
+}
+
+// TransmitterStats are the reception statistics of a transmitter since
+// startup.
+type TransmitterStats struct {
+	ID         int
+	Name       string
+	Received   int
+	Missed     int
+	Skipped    int     // packets not listened for because of a collision
+	FreqError  int     // of the last packet, Hz
+	RSSI       float64 // of the last packet, dBFS
+	BatteryLow bool    // as of the last packet
+	Supercap   float64 // last supercap voltage, NaN when not known
+	SolarCell  float64 // last solar cell voltage, NaN when not known
+}
+
+// Stats are the receiver statistics at Time.
+type Stats struct {
+	Time         time.Time
+	Inits        int // init procedures since startup
+	Transmitters []TransmitterStats
+}
+
+// Event is a change in the health of a transmitter.
+type Event struct {
+	Time    time.Time
+	ID      int
+	Name    string
+	Type    string  // battery_low, battery_ok or supercap_falling
+	Message string  // for people
+	Value   float64 // the voltage of supercap_falling, NaN for the others
+}
+
+// Sink is an output.
+type Sink interface {
+	Observation(o Observation) error
+	Record(r Record) error
+	// Close flushes what is buffered and releases the output.
+	Close() error
+}
+
+// PacketSink is implemented by sinks which also store the raw packets.
+type PacketSink interface {
+	Packet(p Packet) error
+}
+
+// StatsSink is implemented by sinks which also write receiver statistics.
+type StatsSink interface {
+	Stats(st Stats) error
+}
+
+// EventSink is implemented by sinks which also report events.
+type EventSink interface {
+	Event(e Event) error
+}
+
+// DeviceSink is implemented by sinks which announce the transmitters, see
+// MQTTDevice.
+type DeviceSink interface {
+	SetDevices(devs []MQTTDevice) error
+}
+
+// Multi writes to several sinks.
+type Multi []Sink
+
+// Observation writes o to all sinks and returns the first error.
+func (m Multi) Observation(o Observation) (err error) {
+	for _, s := range m {
+		if e := s.Observation(o); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Packet writes p to the sinks which are a PacketSink and returns the first
+// error.
+func (m Multi) Packet(p Packet) (err error) {
+	for _, s := range m {
+		ps, ok := s.(PacketSink)
+		if !ok {
+			continue
+		}
+		if e := ps.Packet(p); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Stats writes st to the sinks which are a StatsSink and returns the first
+// error.
+func (m Multi) Stats(st Stats) (err error) {
+	for _, s := range m {
+		ss, ok := s.(StatsSink)
+		if !ok {
+			continue
+		}
+		if e := ss.Stats(st); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Event writes e to the sinks which are an EventSink and returns the first
+// error.
+func (m Multi) Event(e Event) (err error) {
+	for _, s := range m {
+		es, ok := s.(EventSink)
+		if !ok {
+			continue
+		}
+		if e := es.Event(e); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// SetDevices announces devs with the sinks which are a DeviceSink and
+// returns the first error.
+func (m Multi) SetDevices(devs []MQTTDevice) (err error) {
+	for _, s := range m {
+		ds, ok := s.(DeviceSink)
+		if !ok {
+			continue
+		}
+		if e := ds.SetDevices(devs); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Record writes r to all sinks and returns the first error.
+func (m Multi) Record(r Record) (err error) {
+	for _, s := range m {
+		if e := s.Record(r); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Close closes all sinks and returns the first error.
+func (m Multi) Close() (err error) {
+	for _, s := range m {
+		if e := s.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
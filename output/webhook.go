@@ -0,0 +1,69 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Webhook posts the events to a URL, e.g. of a home automation system or a
+// chat service, as
+// {"time":..., "id":..., "name":..., "event":..., "message":..., "value":...},
+// the value only when it has one.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook returns a webhook output posting to url.
+func NewWebhook(url string) *Webhook {
+	return &Webhook{url: url, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Event posts e.
+func (w *Webhook) Event(e Event) error {
+	m := map[string]interface{}{
+		"time":    e.Time.Format(time.RFC3339),
+		"id":      e.ID,
+		"name":    e.Name,
+		"event":   e.Type,
+		"message": e.Message,
+	}
+	if finite(e.Value) {
+		m["value"] = e.Value
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("webhook: %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Observation does nothing; only events are posted.
+func (w *Webhook) Observation(o Observation) error {
+	return nil
+}
+
+// Record does nothing; only events are posted.
+func (w *Webhook) Record(r Record) error {
+	return nil
+}
+
+// Close does nothing.
+func (w *Webhook) Close() error {
+	return nil
+}
@@ -0,0 +1,49 @@
+package output
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	var got []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		got = append(got, m)
+	}))
+	defer srv.Close()
+
+	at := time.Date(2019, 3, 24, 12, 0, 0, 0, time.UTC)
+	w := NewWebhook(srv.URL)
+	if err := w.Event(Event{at, 0, "ISS", "battery_low", "ISS: battery low", math.NaN()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Event(Event{at, 0, "ISS", "supercap_falling", "ISS: supercap falling", 2.45}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d posts, want 2", len(got))
+	}
+	if got[0]["event"] != "battery_low" || got[0]["time"] != "2019-03-24T12:00:00Z" || got[0]["name"] != "ISS" {
+		t.Errorf("got %v", got[0])
+	}
+	if _, ok := got[0]["value"]; ok {
+		t.Errorf("battery_low has a value: %v", got[0])
+	}
+	if got[1]["value"] != 2.45 {
+		t.Errorf("got %v", got[1])
+	}
+
+	srv.Close()
+	if err := w.Event(Event{Time: at, Type: "battery_ok"}); err == nil {
+		t.Error("no error without a server")
+	}
+}
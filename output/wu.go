@@ -0,0 +1,203 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upload URLs of the Weather Underground PWS protocol, which PWSWeather
+// implements as well.
+const (
+	WUURL          = "https://weatherstation.wunderground.com/weatherstation/updateweatherstation.php"
+	WURapidFireURL = "https://rtupdate.wunderground.com/weatherstation/updateweatherstation.php"
+	PWSWeatherURL  = "https://pwsupdate.pwsweather.com/api/v1/submitwx"
+)
+
+const (
+	wuQueue      = 288 // queued uploads; a day at a 5 minute interval
+	wuMinBackoff = 30 * time.Second
+	wuMaxBackoff = 10 * time.Minute
+	wuCloseWait  = 10 * time.Second // for the queued uploads on Close
+)
+
+// WUOptions are the options of the Weather Underground output.
+type WUOptions struct {
+	URL      string // WUURL, PWSWeatherURL, ...
+	ID       string // station id
+	Password string // station key
+	Interval time.Duration
+
+	// RapidFireURL, if set, gets every observation as a rapid fire update.
+	// The uploads at Interval then only happen while rapid fire fails.
+	RapidFireURL string
+	Software     string
+}
+
+// WU uploads the current conditions with the Weather Underground PWS
+// protocol. An upload which fails is queued, with the time of its
+// conditions, and tried again with an exponential backoff, so nothing is
+// lost while the service is unreachable. Rapid fire updates are not
+// queued: they are only worth anything right away.
+type WU struct {
+	opt     WUOptions
+	client  *http.Client
+	last    time.Time // time of the last regular or successful rapid fire upload
+	queue   []url.Values
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// NewWU returns a Weather Underground output.
+func NewWU(opt WUOptions) *WU {
+	return &WU{opt: opt, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// wuValues converts the values of o to the imperial units of the protocol.
+func (w *WU) wuValues(o Observation) url.Values {
+	q := url.Values{}
+	q.Set("ID", w.opt.ID)
+	q.Set("PASSWORD", w.opt.Password)
+	q.Set("action", "updateraw")
+	q.Set("softwaretype", w.opt.Software)
+	q.Set("dateutc", o.Time.UTC().Format("2006-01-02 15:04:05"))
+	f := func(v float64) float64 { return v*9/5 + 32 }
+	mph := func(v float64) float64 { return v * msToMph }
+	in := func(v float64) float64 { return v * mmToInch }
+	same := func(v float64) float64 { return v }
+	for _, p := range []struct {
+		param, name string
+		conv        func(float64) float64
+		prec        int
+	}{
+		{"tempf", "outTemp", f, 1},
+		{"humidity", "outHumidity", same, 0},
+		{"dewptf", "dewpoint", f, 1},
+		{"winddir", "windDir", same, 0},
+		{"windspeedmph", "windSpeed", mph, 1},
+		// the current gust: the 10 minute gust would lag, above all in
+		// rapid fire updates
+		{"windgustmph", "windSpeed", mph, 1},
+		{"windspdmph_avg2m", "windSpeed2", mph, 1},
+		{"winddir_avg2m", "windDir2", same, 0},
+		{"windgustmph_10m", "windGust10", mph, 1},
+		{"rainin", "hourRain", in, 2},
+		{"dailyrainin", "dayRain", in, 2},
+		{"solarradiation", "radiation", same, 0},
+		{"UV", "UV", same, 1},
+	} {
+		if v, ok := o.Values[p.name]; ok {
+			q.Set(p.param, strconv.FormatFloat(p.conv(v), 'f', p.prec, 64))
+		}
+	}
+	return q
+}
+
+// upload sends q to u.
+func (w *WU) upload(u string, q url.Values) error {
+	resp, err := w.client.Get(u + "?" + q.Encode())
+	if err != nil {
+		// the error has the URL with the password in it
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return fmt.Errorf("upload %s: %s", w.opt.ID, err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("upload %s: %s %s", w.opt.ID, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// fail schedules the next attempt after a failure at now.
+func (w *WU) fail(now time.Time) {
+	w.backoff *= 2
+	if w.backoff < wuMinBackoff {
+		w.backoff = wuMinBackoff
+	}
+	if w.backoff > wuMaxBackoff {
+		w.backoff = wuMaxBackoff
+	}
+	w.retryAt = now.Add(w.backoff)
+}
+
+// Observation uploads o, or queues it when an upload is due.
+func (w *WU) Observation(o Observation) error {
+	now := o.Time
+	if w.opt.RapidFireURL != "" && len(w.queue) == 0 && !now.Before(w.retryAt) {
+		q := w.wuValues(o)
+		q.Set("dateutc", "now")
+		q.Set("realtime", "1")
+		q.Set("rtfreq", "2.5")
+		err := w.upload(w.opt.RapidFireURL, q)
+		if err == nil {
+			w.backoff = 0
+			w.last = now
+			return nil
+		}
+		w.fail(now)
+		// fall back on queued uploads at the interval
+		if now.Sub(w.last) >= w.opt.Interval {
+			w.enqueue(o)
+		}
+		return err
+	}
+	if now.Sub(w.last) >= w.opt.Interval {
+		w.enqueue(o)
+	}
+	return w.flush(now)
+}
+
+func (w *WU) enqueue(o Observation) {
+	w.last = o.Time
+	if len(w.queue) == wuQueue {
+		w.queue = w.queue[1:]
+	}
+	w.queue = append(w.queue, w.wuValues(o))
+}
+
+// flush uploads the queue in order unless it has to wait after a failure.
+func (w *WU) flush(now time.Time) error {
+	if now.Before(w.retryAt) {
+		return nil
+	}
+	for len(w.queue) > 0 {
+		if err := w.upload(w.opt.URL, w.queue[0]); err != nil {
+			w.fail(now)
+			return fmt.Errorf("%s; %d uploads queued, next try in %s", err, len(w.queue), w.backoff)
+		}
+		w.queue = w.queue[1:]
+		w.backoff = 0
+	}
+	return nil
+}
+
+// Record does nothing; uploads are made of the current conditions.
+func (w *WU) Record(r Record) error {
+	return nil
+}
+
+// Close tries the queued uploads once more, whatever the backoff, for at
+// most wuCloseWait. Those which still fail are lost.
+func (w *WU) Close() error {
+	deadline := time.Now().Add(wuCloseWait)
+	for len(w.queue) > 0 {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return fmt.Errorf("upload %s: %d queued uploads lost", w.opt.ID, len(w.queue))
+		}
+		w.client.Timeout = left
+		if err := w.upload(w.opt.URL, w.queue[0]); err != nil {
+			return fmt.Errorf("%s; %d queued uploads lost", err, len(w.queue))
+		}
+		w.queue = w.queue[1:]
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package output
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestWU(t *testing.T) {
+	var got []url.Values
+	down := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		got = append(got, r.URL.Query())
+		w.Write([]byte("success\n"))
+	}))
+	defer srv.Close()
+
+	w := NewWU(WUOptions{URL: srv.URL, ID: "KXXTEST1", Password: "key", Interval: 5 * time.Minute, Software: "rtldavis"})
+	start := time.Date(2019, 3, 24, 12, 0, 0, 0, time.UTC)
+	obs := func(d time.Duration) error {
+		return w.Observation(Observation{Time: start.Add(d), Values: map[string]float64{
+			"outTemp": 20, "windSpeed": 4.4704, "dayRain": 2.54,
+		}})
+	}
+
+	if err := obs(0); err == nil {
+		t.Error("no error while the service is down")
+	}
+	// not due, but the queued upload is tried again after 30s
+	if err := obs(time.Minute); err == nil {
+		t.Error("no error while the service is down")
+	}
+	// within the backoff of a minute nothing is tried
+	if err := obs(90 * time.Second); err != nil {
+		t.Error(err)
+	}
+	down = false
+	if err := obs(5 * time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d uploads, want 2", len(got))
+	}
+	for i, want := range []string{"2019-03-24 12:00:00", "2019-03-24 12:05:00"} {
+		if d := got[i].Get("dateutc"); d != want {
+			t.Errorf("upload %d: dateutc %s, want %s", i, d, want)
+		}
+	}
+	q := got[0]
+	for k, want := range map[string]string{
+		"ID": "KXXTEST1", "PASSWORD": "key", "action": "updateraw",
+		"tempf": "68.0", "windspeedmph": "10.0", "windgustmph": "10.0", "dailyrainin": "0.10",
+	} {
+		if q.Get(k) != want {
+			t.Errorf("%s: got %q, want %q", k, q.Get(k), want)
+		}
+	}
+	if _, ok := q["humidity"]; ok {
+		t.Error("humidity sent without a value")
+	}
+}
+
+func TestWUClose(t *testing.T) {
+	var uploads int
+	down := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		uploads++
+	}))
+	defer srv.Close()
+
+	w := NewWU(WUOptions{URL: srv.URL, Interval: time.Minute})
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		w.Observation(Observation{Time: start.Add(time.Duration(i) * time.Minute)})
+	}
+	if len(w.queue) != 2 {
+		t.Fatalf("%d uploads queued, want 2", len(w.queue))
+	}
+	// on shutdown the queue is tried despite the backoff
+	down = false
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if uploads != 2 || len(w.queue) != 0 {
+		t.Errorf("got %d uploads, %d queued, want 2 and 0", uploads, len(w.queue))
+	}
+}
+
+func TestWUBackoff(t *testing.T) {
+	w := NewWU(WUOptions{URL: "http://127.0.0.1:1", Interval: time.Minute})
+	now := time.Now()
+	for _, want := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute} {
+		w.fail(now)
+		if w.backoff != want {
+			t.Errorf("got %s, want %s", w.backoff, want)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		w.fail(now)
+	}
+	if w.backoff != wuMaxBackoff {
+		t.Errorf("got %s, want %s", w.backoff, wuMaxBackoff)
+	}
+}
+
+func TestWURapidFire(t *testing.T) {
+	var realtime, regular int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rt" {
+			realtime++
+			if r.URL.Query().Get("dateutc") != "now" || r.URL.Query().Get("realtime") != "1" {
+				t.Errorf("rapid fire update %s", r.URL.RawQuery)
+			}
+		} else {
+			regular++
+		}
+	}))
+	defer srv.Close()
+
+	w := NewWU(WUOptions{URL: srv.URL + "/", RapidFireURL: srv.URL + "/rt", Interval: 5 * time.Minute})
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := w.Observation(Observation{Time: start.Add(time.Duration(i) * 2500 * time.Millisecond)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if realtime != 4 || regular != 0 {
+		t.Errorf("got %d rapid fire and %d regular uploads, want 4 and 0", realtime, regular)
+	}
+}
@@ -36,12 +36,14 @@ import (
 var Debug bool
 var Disableafc bool
 
+// A packet is the 2 byte sync word, 6 bytes of data, the 2 byte CRC of the
+// data and 2 trailing bytes, which a repeater sets to its ID.
 func NewPacketConfig(symbolLength int) (cfg dsp.PacketConfig) {
 	return dsp.NewPacketConfig(
 		19200,
 		14,
 		16,
-		80,
+		96,
 		"1100101110001001",
 	)
 }
@@ -117,6 +119,7 @@ type Hop struct {
 	ChannelFreq int
 	FreqError   int
         ExpectedTr  int
+	Offset      int // Hz added by the receiver: -fc and the frequency offset of ExpectedTr
 }
 
 func (h Hop) String() string {
@@ -183,8 +186,8 @@ func (p *Parser) Parse(pkts []dsp.Packet) (msgs []Message) {
 		}
 		seen[s] = true
 
-		// If the checksum fails, bail.
-		if p.Checksum(pkt.Data[2:]) != 0 {
+		// If the checksum fails, bail. It does not cover the trailer.
+		if p.Checksum(pkt.Data[2:10]) != 0 {
 			continue
 		}
 		// Look at the packet's preamble to determine frequency error between
@@ -214,11 +217,14 @@ func (p *Parser) Parse(pkts []dsp.Packet) (msgs []Message) {
 		// measured in radians.
 		freqerr := -int((mean*float64(p.Cfg.SampleRate))/(2*math.Pi))
 		msg := NewMessage(pkt)
-		msgs = append(msgs, msg)
 		// Per transmitter and per channel we have a list of p.maxTrChList frequency errors
 		// The average value of the frequency errors is used for the frequency correction.
 		tr := int(msg.ID)
 		ch := p.hopPattern[p.hopIdx]
+		msg.Channel = ch
+		msg.FreqError = freqerr
+		msg.RSSI = p.rssi(pkt.Idx)
+		msgs = append(msgs, msg)
                 old := p.freqerrTrChAvg[tr][ch]
 		// If AFC is disabled we need to remove the error that would have been corrected away before the new error is added
                 if (Disableafc) {
@@ -233,20 +239,85 @@ func (p *Parser) Parse(pkts []dsp.Packet) (msgs []Message) {
 	return
 }
 
+// rssi returns the mean power in dBFS of the raw samples of the packet
+// starting at sample idx of the demodulator buffer.
+func (p *Parser) rssi(idx int) float64 {
+	end := idx + p.Cfg.PacketLength
+	if end > p.Cfg.BufferLength {
+		end = p.Cfg.BufferLength
+	}
+	if idx >= end {
+		return math.Inf(-1)
+	}
+	var power float64
+	for i := idx; i < end; i++ {
+		re := (float64(p.Raw[2*i]) - 127.4) / 127.6
+		im := (float64(p.Raw[2*i+1]) - 127.4) / 127.6
+		power += re*re + im*im
+	}
+	return 10 * math.Log10(power/float64(end-idx))
+}
+
+// FreqErrorSums returns the per transmitter, per channel sums the frequency
+// error averages are derived from, so they can be persisted.
+func (p *Parser) FreqErrorSums() [8][51]int {
+	return p.freqerrTrChSum
+}
+
+// SetFreqErrorSums restores sums saved by FreqErrorSums and recalculates
+// the frequency error averages.
+func (p *Parser) SetFreqErrorSums(sums [8][51]int) {
+	p.freqerrTrChSum = sums
+	for tr := range sums {
+		for ch := range sums[tr] {
+			p.freqerrTrChAvg[tr][ch] = sums[tr][ch] / 8
+		}
+	}
+}
+
+// A Message is a received packet. Data is the data and the CRC, without
+// the sync word and the trailer.
 type Message struct {
 	dsp.Packet
 	ID 	byte
+	Repeater  int     // repeater 1-8 (A-H) the message came through, 0 when received directly
+	Channel   int     // channel (frequency index) the message was received on
+	FreqError int     // frequency error measured on the preamble in Hz
+	RSSI      float64 // mean signal power over the message in dBFS
 }
 
 func NewMessage(pkt dsp.Packet) (m Message) {
 	m.Idx = pkt.Idx
-	m.Data = make([]byte, len(pkt.Data)-2)
-	copy(m.Data, pkt.Data[2:])
+	m.Data = make([]byte, 8)
+	copy(m.Data, pkt.Data[2:10])
 	m.ID = m.Data[0] & 0x7
+	m.Repeater = RepeaterID(pkt.Data[10:])
 	return m
 }
 
+// RepeaterID returns the repeater of a packet from its trailer: FF FF for a
+// packet sent by the transmitter itself, while a repeater sets the top bit
+// (0x80) of the first byte and its ID 0-7 in the three bits below it; 1-8
+// is returned for repeaters A-H, 0 for none.
+func RepeaterID(trailer []byte) int {
+	if len(trailer) == 0 || trailer[0] == 0xFF || trailer[0]&0x80 == 0 {
+		return 0
+	}
+	return int(trailer[0]>>4&0x7) + 1
+}
+
+// RepeaterName returns the letter of repeater id 1-8 as on the console.
+func RepeaterName(id int) string {
+	if id < 1 || id > 8 {
+		return "-"
+	}
+	return string(rune('A' + id - 1))
+}
+
 func (m Message) String() string {
+	if m.Repeater != 0 {
+		return fmt.Sprintf("{ID:%d via:%s}", m.ID, RepeaterName(m.Repeater))
+	}
 	return fmt.Sprintf("{ID:%d}", m.ID)
 }
 
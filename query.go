@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"config"
+	"output"
+	"store"
+)
+
+// isQuery reports whether the program was started as "rtldavis query".
+func isQuery() bool {
+	return len(os.Args) > 1 && os.Args[1] == "query"
+}
+
+// queryDB is the database queried without -db or a configuration file
+// which sets db.
+const queryDB = "rtldavis.db"
+
+// runQuery implements "rtldavis query": it prints the packets or archive
+// records stored by -db.
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("rtldavis query", flag.ExitOnError)
+	dbPath := fs.String("db", "", "SQLite database written with -db (default the db of -config, or "+queryDB+")")
+	cfgPath := fs.String("config", "", "configuration file of the receiver, for its db setting")
+	since := fs.Duration("since", 24*time.Hour, "print what was stored during this period up to now")
+	id := fs.Int("id", -1, "print only the packets of this transmitter ID; -1 = all")
+	archive := fs.Bool("archive", false, "print the archive records as JSON lines instead of the packets")
+	fs.Parse(args)
+	if *dbPath == "" && *cfgPath != "" {
+		cfg, err := config.Load(*cfgPath)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		*dbPath = cfg.Settings["db"]
+	}
+	if *dbPath == "" {
+		*dbPath = queryDB
+	}
+
+	// store.Open creates a missing database, which would only print nothing
+	if _, err := os.Stat(*dbPath); err != nil {
+		log.Print(err)
+		return 1
+	}
+	db, err := store.Open(*dbPath, 0)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer db.Close()
+	from := time.Now().Add(-*since)
+
+	if *archive {
+		recs, err := db.Records(from)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		j, _ := output.NewJSON("-")
+		for _, r := range recs {
+			if err := j.Record(r); err != nil {
+				log.Print(err)
+				return 1
+			}
+		}
+		return 0
+	}
+
+	pkts, err := db.Packets(from, *id)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	for _, p := range pkts {
+		fmt.Printf("%s ID:%d %02X channel=%d freqerr=%d rssi=%.1f\n",
+			p.Time.Format("2006-01-02 15:04:05.000"), p.ID, p.Data, p.Channel, p.FreqError, p.RSSI)
+	}
+	return 0
+}
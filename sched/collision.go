@@ -0,0 +1,67 @@
+package sched
+
+import (
+	"sort"
+	"time"
+)
+
+// SwitchTime is the minimum time between two packets on different channels
+// needed to receive both: reading and demodulating the block with the first
+// packet, hopping and letting the tuner settle.
+const SwitchTime = 20 * time.Millisecond
+
+// Candidate is the next predicted packet of a transmitter.
+type Candidate struct {
+	At       int64         // predicted arrival in UTC-nanoseconds
+	Window   time.Duration // receive window of its tracker, see Tracker.Window
+	Priority int           // higher is served first in a collision
+	Skipped  int           // scheduled skips since the last received packet
+}
+
+// collides tells whether c is due too close after first to catch both: the
+// packet of first may arrive up to its window after the predicted time and
+// that of c as much before, and the switch between them takes SwitchTime.
+// The learned windows of well known transmitters are short, so they can be
+// due much closer together than those still on LegacyWindow.
+func collides(first, c Candidate) bool {
+	return c.At-int64(c.Window) < first.At+int64(first.Window+SwitchTime)
+}
+
+// Choose returns the index of the candidate to serve next and the indexes
+// of the candidates colliding with it, which are skipped. Candidates
+// collide when they are due too close after the first one, see collides. Of
+// colliding candidates the one with the highest priority is served; with
+// equal priorities the one skipped most often, so transmitters with equal
+// priorities take turns, and then the earliest.
+func Choose(cands []Candidate) (serve int, skip []int) {
+	if len(cands) == 0 {
+		return -1, nil
+	}
+	order := make([]int, len(cands))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return cands[order[a]].At < cands[order[b]].At
+	})
+
+	first := cands[order[0]]
+	serve = order[0]
+	colliding := []int{order[0]}
+	for _, i := range order[1:] {
+		if !collides(first, cands[i]) {
+			continue
+		}
+		colliding = append(colliding, i)
+		c, s := cands[i], cands[serve]
+		if c.Priority > s.Priority || c.Priority == s.Priority && c.Skipped > s.Skipped {
+			serve = i
+		}
+	}
+	for _, i := range colliding {
+		if i != serve {
+			skip = append(skip, i)
+		}
+	}
+	return serve, skip
+}
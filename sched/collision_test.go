@@ -0,0 +1,40 @@
+package sched
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChoose(t *testing.T) {
+	ms := int64(time.Millisecond)
+	for _, tc := range []struct {
+		name  string
+		cands []Candidate
+		serve int
+		skip  []int
+	}{
+		{"none", nil, -1, nil},
+		{"no collision", []Candidate{{At: 200 * ms}, {At: 50 * ms}, {At: 123 * ms}}, 1, nil},
+		{"legacy windows", []Candidate{{At: 50*ms + int64(62500*time.Microsecond), Window: LegacyWindow}, {At: 50 * ms, Window: LegacyWindow}}, 1, []int{0}},
+		{"learned windows", []Candidate{{At: 50*ms + int64(62500*time.Microsecond)}, {At: 50 * ms}}, 1, nil},
+		{"one learned window", []Candidate{{At: 50*ms + int64(62500*time.Microsecond)}, {At: 50 * ms, Window: LegacyWindow}}, 1, []int{0}},
+		{"wide window of a later one", []Candidate{{At: 50 * ms}, {At: 115 * ms}, {At: 180 * ms, Window: LegacyWindow + 50*time.Millisecond}}, 0, []int{2}},
+		{"earliest", []Candidate{{At: 60 * ms}, {At: 50 * ms}}, 1, []int{0}},
+		{"priority", []Candidate{{At: 60 * ms, Priority: 2}, {At: 50 * ms, Priority: 1}}, 0, []int{1}},
+		{"take turns", []Candidate{{At: 60 * ms, Skipped: 1}, {At: 50 * ms}}, 0, []int{1}},
+		{"priority before turns", []Candidate{{At: 60 * ms, Skipped: 3}, {At: 50 * ms, Priority: 1}}, 1, []int{0}},
+		{"all equal", []Candidate{{At: 50 * ms}, {At: 50 * ms}, {At: 50 * ms}}, 0, []int{1, 2}},
+		{"three", []Candidate{{At: 65 * ms}, {At: 50 * ms}, {At: 55 * ms, Priority: 1}, {At: 200 * ms}}, 2, []int{1, 0}},
+	} {
+		for i := range tc.cands {
+			if tc.cands[i].Window == 0 {
+				tc.cands[i].Window = MinWindow
+			}
+		}
+		serve, skip := Choose(tc.cands)
+		if serve != tc.serve || !reflect.DeepEqual(skip, tc.skip) {
+			t.Errorf("%s: got %d %v, want %d %v", tc.name, serve, skip, tc.serve, tc.skip)
+		}
+	}
+}
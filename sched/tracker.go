@@ -0,0 +1,148 @@
+// Package sched contains the timing logic used to schedule channel hops.
+package sched
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// LegacyWindow is the time we keep listening after the predicted
+	// arrival of a packet while a transmitter's timing is not known well.
+	LegacyWindow = 62500*time.Microsecond + 10*time.Millisecond
+	// MinWindow is the shortest time we keep listening after the predicted
+	// arrival; it covers the latency of reading and demodulating a block.
+	MinWindow = 20 * time.Millisecond
+	// RelayWindow is the shortest window for a transmitter received
+	// through a repeater, whose relay delay varies from packet to packet.
+	RelayWindow = 40 * time.Millisecond
+
+	alpha      = 0.3  // phase gain of the tracking filter
+	beta       = 0.02 // period gain of the tracking filter
+	jitterGain = 0.1  // weight of a new residual in the jitter estimate
+	maxDrift   = 200  // period may deviate 1/maxDrift from the nominal one
+	minUpdates = 8    // updates needed before the window is tightened
+)
+
+// Tracker learns the actual hop period and phase of one transmitter from
+// the arrival times of its packets, using an alpha-beta tracking filter.
+// Times are in UTC-nanoseconds like the rest of the scheduler.
+type Tracker struct {
+	nominal float64 // nominal period in ns
+	period  float64 // estimated period in ns
+	last    float64 // estimated time of the last visit in ns
+	jitter  float64 // estimated variance of the arrival residuals in ns²
+	updates int     // number of arrivals the estimate is based on
+	relayed bool    // received through a repeater
+}
+
+// NewTracker returns a tracker for a transmitter with the given nominal
+// period, e.g. 2562500µs + ID*62500µs.
+func NewTracker(nominal time.Duration) Tracker {
+	return Tracker{nominal: float64(nominal), period: float64(nominal)}
+}
+
+// SetRelayed tells whether the transmitter is received through a repeater.
+// Its packets arrive a relay delay later than those of the transmitter
+// itself, with the same period; the delay becomes part of the phase, but
+// the window stays wide enough for its variation.
+func (tr *Tracker) SetRelayed(relayed bool) {
+	tr.relayed = relayed
+}
+
+// Reset restarts tracking with a packet received at t, keeping the period
+// learned so far.
+func (tr *Tracker) Reset(t int64) {
+	tr.last = float64(t)
+	tr.jitter = 0
+	tr.updates = 0
+}
+
+// Update feeds the arrival time of a packet to the filter and returns the
+// difference between the predicted and the actual arrival.
+func (tr *Tracker) Update(t int64) (residual time.Duration) {
+	if tr.last == 0 {
+		tr.Reset(t)
+		return 0
+	}
+
+	// The packet may arrive several periods after the last visit, when
+	// visits were missed without a call to Miss.
+	periods := math.Floor((float64(t)-tr.last)/tr.period + 0.5)
+	if periods < 1 {
+		periods = 1
+	}
+	e := float64(t) - (tr.last + periods*tr.period)
+	if math.Abs(e) > tr.period/4 {
+		// Too far off to be a drift: we lost the phase.
+		tr.Reset(t)
+		return time.Duration(e)
+	}
+
+	tr.last += periods*tr.period + alpha*e
+	tr.period += beta * e / periods
+	if lo, hi := tr.nominal*(1-1.0/maxDrift), tr.nominal*(1+1.0/maxDrift); tr.period < lo {
+		tr.period = lo
+	} else if tr.period > hi {
+		tr.period = hi
+	}
+	if tr.updates == 0 {
+		tr.jitter = e * e
+	} else {
+		tr.jitter += jitterGain * (e*e - tr.jitter)
+	}
+	tr.updates++
+	return time.Duration(e)
+}
+
+// Miss advances the phase by one period for a visit without a packet.
+func (tr *Tracker) Miss() {
+	tr.last += tr.period
+}
+
+// Period returns the estimated period.
+func (tr *Tracker) Period() time.Duration {
+	return time.Duration(tr.period)
+}
+
+// SetPeriod restores a previously learned period.
+func (tr *Tracker) SetPeriod(p time.Duration) {
+	if math.Abs(float64(p)-tr.nominal) <= tr.nominal/maxDrift {
+		tr.period = float64(p)
+	}
+}
+
+// Last returns the estimated time of the last visit.
+func (tr *Tracker) Last() int64 {
+	return int64(tr.last)
+}
+
+// Next returns the predicted arrival time of the first packet after now and
+// the number of periods (hops) between the last visit and that arrival.
+func (tr *Tracker) Next(now int64) (next int64, periods int) {
+	at := tr.last
+	for at <= float64(now) {
+		at += tr.period
+		periods++
+	}
+	return int64(at), periods
+}
+
+// Window returns how long to keep listening after the predicted arrival.
+// It shrinks from LegacyWindow as the arrival jitter becomes known.
+func (tr *Tracker) Window() time.Duration {
+	if tr.updates < minUpdates {
+		return LegacyWindow
+	}
+	w := 10*time.Millisecond + time.Duration(4*math.Sqrt(tr.jitter))
+	if tr.relayed && w < RelayWindow {
+		return RelayWindow
+	}
+	if w < MinWindow {
+		return MinWindow
+	}
+	if w > LegacyWindow {
+		return LegacyWindow
+	}
+	return w
+}
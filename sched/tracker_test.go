@@ -0,0 +1,78 @@
+package sched
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestTrackerConverges(t *testing.T) {
+	nominal := 2562500 * time.Microsecond
+	actual := nominal + 400*time.Microsecond // a transmitter running slow
+	rnd := rand.New(rand.NewSource(1))
+
+	tr := NewTracker(nominal)
+	start := int64(1e18)
+	for n := 0; n < 400; n++ {
+		at := start + int64(n)*int64(actual) + int64(rnd.NormFloat64()*float64(time.Millisecond))
+		if n%7 == 3 {
+			tr.Miss() // packet missed
+			continue
+		}
+		if n%11 == 5 {
+			continue // packet missed without notice
+		}
+		tr.Update(at)
+	}
+
+	if d := tr.Period() - actual; d < -50*time.Microsecond || d > 50*time.Microsecond {
+		t.Errorf("period %s, want %s", tr.Period(), actual)
+	}
+	now := start + 400*int64(actual) - int64(time.Second)
+	next, _ := tr.Next(now)
+	if d := time.Duration(next - (start + 400*int64(actual))); d < -3*time.Millisecond || d > 3*time.Millisecond {
+		t.Errorf("predicted arrival off by %s", d)
+	}
+	if w := tr.Window(); w >= LegacyWindow || w < MinWindow {
+		t.Errorf("window %s not tightened", w)
+	}
+}
+
+func TestTrackerNext(t *testing.T) {
+	tr := NewTracker(time.Second)
+	if w := tr.Window(); w != LegacyWindow {
+		t.Errorf("window %s, want %s", w, LegacyWindow)
+	}
+	tr.Update(int64(10 * time.Second))
+	next, periods := tr.Next(int64(12500 * time.Millisecond))
+	if next != int64(13*time.Second) || periods != 3 {
+		t.Errorf("Next: got %d, %d; want %d, 3", next, periods, int64(13*time.Second))
+	}
+}
+
+func TestTrackerLostPhase(t *testing.T) {
+	tr := NewTracker(time.Second)
+	tr.Update(int64(10 * time.Second))
+	tr.Update(int64(11 * time.Second))
+	tr.Update(int64(12400 * time.Millisecond))
+	if tr.Last() != int64(12400*time.Millisecond) {
+		t.Errorf("phase not reset: last %d", tr.Last())
+	}
+}
+
+func TestTrackerRelayed(t *testing.T) {
+	nominal := 2562500 * time.Microsecond
+	tr := NewTracker(nominal)
+	tr.SetRelayed(true)
+	start := int64(1e18)
+	for n := 0; n < 2*minUpdates; n++ {
+		tr.Update(start + int64(n)*int64(nominal))
+	}
+	if w := tr.Window(); w != RelayWindow {
+		t.Errorf("window %s, want %s", w, RelayWindow)
+	}
+	tr.SetRelayed(false)
+	if w := tr.Window(); w != MinWindow {
+		t.Errorf("window %s, want %s", w, MinWindow)
+	}
+}
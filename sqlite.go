@@ -0,0 +1,9 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+// The SQLite driver needs cgo, so it is only built in on request:
+//
+//	go install -tags sqlite .
+import _ "github.com/mattn/go-sqlite3"
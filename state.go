@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"protocol"
+	"weather"
+)
+
+// receiverState is the part of the receiver state which is worth keeping
+// across restarts.
+type receiverState struct {
+	Saved      time.Time
+	FreqErrors [8][51]int // frequency error sums per transmitter per channel
+	Periods    [8]int64   // learned loop periods per id in ns
+	Rain       [8]weather.Rain
+	Day        weather.DayStats // highs and lows of the current day
+	Health     [8]weather.Health
+}
+
+// loadState restores the receiver state saved by saveState. A missing file
+// is not an error: there is simply nothing to restore yet.
+func loadState(path string, p *protocol.Parser) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var st receiverState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	p.SetFreqErrorSums(st.FreqErrors)
+	for id, period := range st.Periods {
+		if period != 0 {
+			idTrackers[id].SetPeriod(time.Duration(period))
+		}
+	}
+	for id, rain := range st.Rain {
+		// Day is always set once the counter is known; a state from before
+		// rain was saved has the zero Rain
+		if rain.Counter >= 0 && rain.Day != "" {
+			station.Rain[id] = rain
+		}
+	}
+	// highs and lows of another day are dropped with the first reading
+	station.Stats.Day = st.Day
+	health = st.Health
+	return nil
+}
+
+// saveState writes the receiver state to a temporary file first and renames
+// it into place so an interrupted write never leaves a truncated state.
+func saveState(path string, p *protocol.Parser) error {
+	st := receiverState{
+		Saved:      time.Now(),
+		FreqErrors: p.FreqErrorSums(),
+		Rain:       station.Rain,
+		Day:        station.Stats.Day,
+		Health:     health,
+	}
+	for id := range idTrackers {
+		st.Periods[id] = int64(idTrackers[id].Period())
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"census"
+	"config"
+	"output"
+	"protocol"
+	"store"
+	"weather"
+)
+
+var (
+	station *weather.Station // current conditions and rain per id
+	outputs output.Multi     // structured outputs, see openOutputs
+	archive *weather.Archive // nil without archive records
+
+	idModels [8]weather.ModelDetector // of the ISSes of type auto
+	health   [8]weather.Health        // battery and supercap per id
+)
+
+// parseBucket converts the -bucket setting to mm per tip. Without a setting
+// the bucket Davis sells for the region of the frequencies is assumed.
+func parseBucket(s, tf string) (float64, error) {
+	switch s {
+	case "0.01in":
+		return weather.Bucket001In, nil
+	case "0.2mm":
+		return weather.Bucket02mm, nil
+	case "":
+		if tf == "US" {
+			return weather.Bucket001In, nil
+		}
+		return weather.Bucket02mm, nil
+	}
+	return 0, fmt.Errorf("bucket %q: expected 0.01in or 0.2mm", s)
+}
+
+// parseDayStart converts the -daystart setting HH:MM to the time after
+// local midnight.
+func parseDayStart(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("daystart %q: expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// newArchive returns an archive with an interval of minutes starting now.
+func newArchive(minutes int) (*weather.Archive, error) {
+	interval := time.Duration(minutes) * time.Minute
+	for _, i := range weather.ArchiveIntervals {
+		if i == interval {
+			return weather.NewArchive(interval, time.Now()), nil
+		}
+	}
+	return nil, fmt.Errorf("archive %d: expected 1, 5, 10, 15, 30 or 60 minutes", minutes)
+}
+
+// writeArchive passes the archive record of the interval ending at end to
+// the outputs. The reception of a transmitter is the number of its packets
+// received against the number expected from its loop period.
+func writeArchive(end time.Time) {
+	rec := output.Record{Time: end, Interval: archive.Interval}
+	d := end.Sub(archive.Start)
+	rx := ""
+	for ch := 0; ch < maxChan; ch++ {
+		id := actChan[ch]
+		expected := float64(d) / float64(idTrackers[id].Period())
+		pct := 100.0
+		if expected > 0 {
+			pct = math.Min(100, 100*float64(idPackets[id])/expected)
+		}
+		rec.Reception = append(rec.Reception, output.Reception{ID: id, Name: trName(id), Percent: pct})
+		rx += fmt.Sprintf(" ID:%d=%.0f%%", id, pct)
+		idPackets[id] = 0
+	}
+	rec.Values = archive.Record(end)
+	log.Printf("Archive %s: reception%s", end.Format("15:04"), rx)
+	if err := outputs.Record(rec); err != nil {
+		log.Printf("Output error: %s", err)
+	}
+}
+
+// writeStats passes the receiver statistics to the outputs.
+func writeStats() {
+	st := output.Stats{Time: time.Now(), Inits: totInit}
+	for ch := 0; ch < maxChan; ch++ {
+		id := actChan[ch]
+		missed := 0
+		for _, n := range chMissPerFreq[id] {
+			missed += n
+		}
+		st.Transmitters = append(st.Transmitters, output.TransmitterStats{
+			ID:         id,
+			Name:       trName(id),
+			Received:   chTotMsgs[ch],
+			Missed:     missed,
+			Skipped:    chSkips[ch],
+			FreqError:  idFreqErrors[id],
+			RSSI:       idRSSIs[id],
+			BatteryLow: health[id].BatteryLow,
+			Supercap:   voltage(health[id].Supercap),
+			SolarCell:  voltage(health[id].SolarCell),
+		})
+	}
+	if err := outputs.Stats(st); err != nil {
+		log.Printf("Output error: %s", err)
+	}
+}
+
+// Schemas of the packet log line, see -schema.
+const (
+	// schemaLegacy is the line older weewx-rtldavis versions parse: the
+	// packet, the packet counters of the first four transmitters listened
+	// for and the number of inits.
+	schemaLegacy = 1
+	// schemaAllIDs has the packet counters of all eight IDs, 0 for those not
+	// listened for, and ends in schema=2.
+	schemaAllIDs = 2
+)
+
+// packetLine returns the log line of a packet of a transmitter listened for.
+func packetLine(msg protocol.Message) string {
+	var counts [8]int // per ID
+	for ch := 0; ch < maxChan; ch++ {
+		counts[actChan[ch]] = chTotMsgs[ch]
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%02X", msg.Data)
+	if logSchema == schemaLegacy {
+		for ch := 0; ch < 4; ch++ {
+			n := 0
+			if ch < maxChan {
+				n = counts[actChan[ch]]
+			}
+			fmt.Fprintf(&b, " %d", n)
+		}
+	} else {
+		for _, n := range counts {
+			fmt.Fprintf(&b, " %d", n)
+		}
+	}
+	fmt.Fprintf(&b, " %d msg.ID=%d", totInit, msg.ID)
+	// the legacy line stays as older weewx-rtldavis versions have always
+	// seen it
+	if logSchema != schemaLegacy {
+		if trConfig[msg.ID].Name != "" {
+			fmt.Fprintf(&b, " name=%q", trConfig[msg.ID].Name)
+		}
+		fmt.Fprintf(&b, " schema=%d", logSchema)
+	}
+	if *undefined {
+		fmt.Fprintf(&b, " undefined:%d", idUndefs)
+	}
+	return b.String()
+}
+
+// censusPacket returns a packet received at t for the census.
+func censusPacket(msg protocol.Message, t int64) census.Packet {
+	id := int(msg.ID)
+	r := weather.Decode(msg.Data, convTim(t), weather.Options{})
+	kind := ""
+	switch {
+	case len(r.Probes) > 0:
+		kind = "leaf_soil"
+	case r.Kind != weather.KindNone:
+		kind = r.Kind.String()
+	}
+	return census.Packet{
+		Time:      convTim(t),
+		ID:        id,
+		Defined:   msgIdToChan[id] != 9,
+		Channel:   msg.Channel,
+		RSSI:      msg.RSSI,
+		FreqError: msg.FreqError,
+		Kind:      kind,
+		Repeater:  msg.Repeater,
+	}
+}
+
+// logCensus logs the table of census c.
+func logCensus(c *census.Census) {
+	var buf bytes.Buffer
+	c.WriteTable(&buf)
+	log.Printf("Census of the transmitters heard:")
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		log.Print(line)
+	}
+}
+
+// voltage returns a voltage of weather.Health for the output, NaN when it
+// is not known.
+func voltage(v float64) float64 {
+	if v == 0 {
+		return math.NaN()
+	}
+	return v
+}
+
+// reportEvent logs a health event and passes it to the outputs.
+func reportEvent(e weather.HealthEvent) {
+	name := trName(e.ID)
+	var msg string
+	switch e.Type {
+	case weather.EventBatteryLow:
+		msg = fmt.Sprintf("%s: battery low, replace it soon", name)
+	case weather.EventBatteryOK:
+		msg = fmt.Sprintf("%s: battery ok", name)
+	case weather.EventSupercapFalling:
+		msg = fmt.Sprintf("%s: supercap minimum falling for days, now %.2fV; check the solar cell and the battery", name, e.Value)
+	default:
+		msg = fmt.Sprintf("%s: %s", name, e.Type)
+	}
+	log.Printf("ID:%d %s", e.ID, msg)
+	value := math.NaN()
+	if e.Type == weather.EventSupercapFalling {
+		value = e.Value
+	}
+	err := outputs.Event(output.Event{Time: e.Time, ID: e.ID, Name: name, Type: e.Type, Message: msg, Value: value})
+	if err != nil {
+		log.Printf("Output error: %s", err)
+	}
+}
+
+// mqttDevices returns the transmitters listened for as announced to Home
+// Assistant.
+func mqttDevices() (devs []output.MQTTDevice) {
+	for ch := 0; ch < maxChan; ch++ {
+		id := actChan[ch]
+		devs = append(devs, output.MQTTDevice{ID: id, Name: trName(id), Type: trConfig[id].Type, NoWind: decodeOptions(id).NoWind})
+	}
+	return devs
+}
+
+// announceDevices announces the transmitters again after they were
+// reconfigured.
+func announceDevices() {
+	if err := outputs.SetDevices(mqttDevices()); err != nil {
+		log.Printf("Output error: %s", err)
+	}
+}
+
+// openOutputs opens the structured outputs selected by the flags.
+func openOutputs() (output.Multi, error) {
+	var m output.Multi
+	if *jsonOut != "" {
+		j, err := output.NewJSON(*jsonOut)
+		if err != nil {
+			return nil, err
+		}
+		m = append(m, j)
+	}
+	if *influxOut != "" {
+		x, err := output.NewInflux(*influxOut)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		if strings.HasPrefix(*influxOut, "http") {
+			m = append(m, output.NewAsync(x, 100))
+		} else {
+			m = append(m, x)
+		}
+	}
+	if *csvDir != "" {
+		if *csvRotate != "day" && *csvRotate != "month" {
+			m.Close()
+			return nil, fmt.Errorf("csvrotate %q: expected day or month", *csvRotate)
+		}
+		var columns []string
+		if *csvColumns != "" {
+			for _, col := range strings.Split(*csvColumns, ",") {
+				columns = append(columns, strings.TrimSpace(col))
+			}
+		}
+		c, err := output.NewCSV(*csvDir, *csvRotate == "month", columns)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m = append(m, c)
+	}
+	if *mqttAddr != "" {
+		opt := output.MQTTOptions{Topic: *mqttTopic, Discovery: *hassPrefix}
+		opt.Addr = *mqttAddr
+		opt.ClientID = "rtldavis-" + *mqttTopic
+		opt.Username = *mqttUser
+		opt.Password = *mqttPass
+		opt.Devices = mqttDevices()
+		m = append(m, output.NewAsync(output.NewMQTT(opt), 100))
+	}
+	if *cwopCall != "" {
+		if latitude == 0 && longitude == 0 {
+			m.Close()
+			return nil, fmt.Errorf("cwop needs the location of the station: -lat and -lon")
+		}
+		if cwopMinutes < 5 {
+			m.Close()
+			return nil, fmt.Errorf("cwopinterval %d: CWOP accepts a report every 5 minutes at most", cwopMinutes)
+		}
+		c := output.NewCWOP(output.CWOPOptions{
+			Call:     strings.ToUpper(*cwopCall),
+			Passcode: *cwopPass,
+			Server:   *cwopServer,
+			Interval: time.Duration(cwopMinutes) * time.Minute,
+			Lat:      latitude,
+			Lon:      longitude,
+			Software: "rtldavis",
+		})
+		m = append(m, output.NewAsync(c, 100))
+	}
+	if *wuID != "" {
+		opt := output.WUOptions{
+			URL:      *wuURL,
+			ID:       *wuID,
+			Password: *wuPass,
+			Interval: time.Duration(wuMinutes) * time.Minute,
+			Software: "rtldavis",
+		}
+		if *wuRapid {
+			opt.RapidFireURL = *wuURL
+			if *wuURL == output.WUURL {
+				opt.RapidFireURL = output.WURapidFireURL
+			}
+		}
+		m = append(m, output.NewAsync(output.NewWU(opt), 100))
+	}
+	if *webhookURL != "" {
+		m = append(m, output.NewAsync(output.NewWebhook(*webhookURL), 100))
+	}
+	if *dbPath != "" {
+		db, err := store.Open(*dbPath, time.Duration(dbDays)*24*time.Hour)
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("%s: %s", *dbPath, err)
+		}
+		// a write to a slow SD card must not delay the next hop
+		m = append(m, output.NewAsync(db, 100))
+	}
+	return m, nil
+}
+
+// decodeOptions returns how to decode the packets of transmitter id. When
+// an anemometer transmitter kit is active the station's wind is its wind
+// only; the ISS keeps reporting the rest.
+func decodeOptions(id int) weather.Options {
+	opt := weather.Options{
+		Bucket:    station.Bucket,
+		Type:      trType(id),
+		DirOffset: float64(trConfig[id].WindOffset),
+	}
+	if opt.Type != config.TypeAnemometer {
+		for ch := 0; ch < maxChan; ch++ {
+			if trConfig[actChan[ch]].Type == config.TypeAnemometer {
+				opt.NoWind = true
+			}
+		}
+	}
+	return opt
+}
+
+// handleData decodes the sensor data of a packet of a defined transmitter
+// and passes the resulting conditions to the outputs.
+func handleData(msg protocol.Message, t time.Time) {
+	idFreqErrors[msg.ID] = msg.FreqError
+	idRSSIs[msg.ID] = msg.RSSI
+	if trConfig[msg.ID].Type == config.TypeAuto && idModels[msg.ID].Model() == "" {
+		idModels[msg.ID].Add(msg.Data)
+		switch idModels[msg.ID].Model() {
+		case config.TypeISS:
+			log.Printf("ID:%d is a Vantage Pro2 ISS", msg.ID)
+		case config.TypeVue:
+			log.Printf("ID:%d is a Vantage Vue ISS", msg.ID)
+		}
+	}
+	r := weather.Decode(msg.Data, t, decodeOptions(int(msg.ID)))
+	for _, e := range health[r.ID].Update(r) {
+		reportEvent(e)
+	}
+	tips := station.Update(r)
+	if tips > 0 {
+		tot := station.Rain[r.ID].Totals(t, station.Bucket)
+		log.Printf("ID:%d rain %d tips: day=%.1fmm hour=%.1fmm 24h=%.1fmm storm=%.1fmm",
+			r.ID, tips, tot.Day, tot.Hour, tot.Day24, tot.Storm)
+	}
+	if archive != nil {
+		rain := math.NaN()
+		if r.Kind == weather.KindRain && r.Valid && station.Rain[r.ID].Counter >= 0 {
+			rain = float64(tips) * station.Bucket
+		}
+		archive.Add(r, rain)
+	}
+	if len(outputs) == 0 {
+		return
+	}
+	pkt := output.Packet{
+		Time:      t,
+		ID:        int(msg.ID),
+		Name:      trName(int(msg.ID)),
+		Data:      msg.Data,
+		Channel:   msg.Channel,
+		FreqError: msg.FreqError,
+		RSSI:      msg.RSSI,
+	}
+	if err := outputs.Packet(pkt); err != nil {
+		log.Printf("Output error: %s", err)
+	}
+	o := output.Observation{
+		Time:   t,
+		ID:     r.ID,
+		Name:   trName(r.ID),
+		Type:   trType(r.ID),
+		Values: station.Conditions(t).Values(),
+	}
+	if err := outputs.Observation(o); err != nil {
+		log.Printf("Output error: %s", err)
+	}
+}
@@ -0,0 +1,194 @@
+// Package store keeps received packets and archive records in an SQLite
+// database, to investigate reception problems and to backfill after an
+// outage of the program the data normally goes to.
+//
+// The package only uses database/sql. The SQLite driver is registered by
+// the main program when it is built with the sqlite build tag, so the
+// receiver still builds without cgo.
+package store
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"output"
+)
+
+// Driver is the database/sql driver name of SQLite.
+const Driver = "sqlite3"
+
+// ErrNoDriver is returned by Open when the SQLite driver is not built in.
+var ErrNoDriver = errors.New("SQLite support not built in; build with -tags sqlite")
+
+// pruneEvery is how often expired rows are deleted.
+const pruneEvery = time.Hour
+
+const schema = `
+CREATE TABLE IF NOT EXISTS packets (
+	time       INTEGER NOT NULL, -- Unix nanoseconds
+	id         INTEGER NOT NULL,
+	data       TEXT NOT NULL,    -- hex
+	channel    INTEGER NOT NULL,
+	freq_error INTEGER NOT NULL, -- Hz
+	rssi       REAL              -- dBFS
+);
+CREATE INDEX IF NOT EXISTS packets_time ON packets (time);
+CREATE TABLE IF NOT EXISTS archive (
+	time      INTEGER PRIMARY KEY, -- end of the interval, Unix nanoseconds
+	interval  INTEGER NOT NULL,    -- seconds
+	vals      TEXT NOT NULL,       -- JSON object of the weewx archive fields
+	reception TEXT NOT NULL        -- JSON array of the reception per transmitter
+);
+`
+
+// DB is an output storing packets and archive records. Loop observations
+// are not stored: they are derived from the packets.
+type DB struct {
+	db     *sql.DB
+	retain time.Duration
+	pruned time.Time
+}
+
+// Open opens or creates the database at path. Rows older than retain are
+// deleted; with retain 0 they are kept.
+func Open(path string, retain time.Duration) (*DB, error) {
+	found := false
+	for _, d := range sql.Drivers() {
+		found = found || d == Driver
+	}
+	if !found {
+		return nil, ErrNoDriver
+	}
+	db, err := sql.Open(Driver, path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer; a single connection avoids busy errors.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	d := &DB{db: db, retain: retain}
+	if err := d.prune(time.Now()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// prune deletes the rows which are older than the retention at now.
+func (d *DB) prune(now time.Time) error {
+	d.pruned = now
+	if d.retain == 0 {
+		return nil
+	}
+	before := now.Add(-d.retain).UnixNano()
+	if _, err := d.db.Exec(`DELETE FROM packets WHERE time < ?`, before); err != nil {
+		return err
+	}
+	_, err := d.db.Exec(`DELETE FROM archive WHERE time < ?`, before)
+	return err
+}
+
+// Packet stores p.
+func (d *DB) Packet(p output.Packet) error {
+	if p.Time.Sub(d.pruned) >= pruneEvery {
+		if err := d.prune(p.Time); err != nil {
+			return err
+		}
+	}
+	_, err := d.db.Exec(`INSERT INTO packets (time, id, data, channel, freq_error, rssi) VALUES (?, ?, ?, ?, ?, ?)`,
+		p.Time.UnixNano(), p.ID, hex.EncodeToString(p.Data), p.Channel, p.FreqError, p.RSSI)
+	return err
+}
+
+// Observation does nothing, see DB.
+func (d *DB) Observation(o output.Observation) error {
+	return nil
+}
+
+// Record stores r, replacing a record with the same time.
+func (d *DB) Record(r output.Record) error {
+	vals, err := json.Marshal(r.Values)
+	if err != nil {
+		return err
+	}
+	rx, err := json.Marshal(r.Reception)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(`INSERT OR REPLACE INTO archive (time, interval, vals, reception) VALUES (?, ?, ?, ?)`,
+		r.Time.UnixNano(), int64(r.Interval/time.Second), string(vals), string(rx))
+	return err
+}
+
+// Packets returns the packets received after since in the order they were
+// received; only those of transmitter id unless id is negative.
+func (d *DB) Packets(since time.Time, id int) ([]output.Packet, error) {
+	rows, err := d.db.Query(`SELECT time, id, data, channel, freq_error, rssi FROM packets
+		WHERE time > ? AND (? < 0 OR id = ?) ORDER BY time`, since.UnixNano(), id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pkts []output.Packet
+	for rows.Next() {
+		var (
+			p    output.Packet
+			t    int64
+			data string
+		)
+		if err := rows.Scan(&t, &p.ID, &data, &p.Channel, &p.FreqError, &p.RSSI); err != nil {
+			return nil, err
+		}
+		p.Time = time.Unix(0, t)
+		if p.Data, err = hex.DecodeString(data); err != nil {
+			return nil, err
+		}
+		pkts = append(pkts, p)
+	}
+	return pkts, rows.Err()
+}
+
+// Records returns the archive records of the intervals ending after since
+// in time order.
+func (d *DB) Records(since time.Time) ([]output.Record, error) {
+	rows, err := d.db.Query(`SELECT time, interval, vals, reception FROM archive
+		WHERE time > ? ORDER BY time`, since.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recs []output.Record
+	for rows.Next() {
+		var (
+			r        output.Record
+			t, secs  int64
+			vals, rx string
+		)
+		if err := rows.Scan(&t, &secs, &vals, &rx); err != nil {
+			return nil, err
+		}
+		r.Time = time.Unix(0, t)
+		r.Interval = time.Duration(secs) * time.Second
+		if err := json.Unmarshal([]byte(vals), &r.Values); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(rx), &r.Reception); err != nil {
+			return nil, err
+		}
+		recs = append(recs, r)
+	}
+	return recs, rows.Err()
+}
+
+// Close closes the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
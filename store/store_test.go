@@ -0,0 +1,80 @@
+//go:build sqlite
+// +build sqlite
+
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"output"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtldavis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rtldavis.db")
+
+	now := time.Now()
+	d, err := Open(path, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range []output.Packet{
+		{Time: now.Add(-25 * time.Hour), ID: 0, Name: "ISS", Data: []byte{0x80, 0x00}, Channel: 1, FreqError: 0, RSSI: -20},
+		{Time: now.Add(-2 * time.Hour), ID: 0, Name: "ISS", Data: []byte{0x80, 0x01}, Channel: 2, FreqError: -1500, RSSI: -21.5},
+		{Time: now.Add(-time.Hour), ID: 1, Data: []byte{0x81, 0x02}, Channel: 3, FreqError: 200, RSSI: -30},
+	} {
+		if err := d.Packet(p); err != nil {
+			t.Fatalf("packet %d: %s", i, err)
+		}
+	}
+	rec := output.Record{
+		Time:      now,
+		Interval:  5 * time.Minute,
+		Values:    map[string]float64{"outTemp": 12.5},
+		Reception: []output.Reception{{ID: 0, Name: "ISS", Percent: 98}},
+	}
+	if err := d.Record(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopening prunes the packet from before the retention
+	if d, err = Open(path, 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	pkts, err := d.Packets(now.Add(-48*time.Hour), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkts) != 2 {
+		t.Fatalf("got %d packets, want 2", len(pkts))
+	}
+	if p := pkts[0]; !bytes.Equal(p.Data, []byte{0x80, 0x01}) || p.Channel != 2 || p.FreqError != -1500 || p.RSSI != -21.5 || !p.Time.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("got %+v", p)
+	}
+	if pkts, err = d.Packets(now.Add(-48*time.Hour), 1); err != nil || len(pkts) != 1 || pkts[0].ID != 1 {
+		t.Errorf("id 1: got %+v, %v", pkts, err)
+	}
+
+	recs, err := d.Records(now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].Values["outTemp"] != 12.5 || recs[0].Interval != 5*time.Minute || recs[0].Reception[0].Name != "ISS" {
+		t.Errorf("got %+v", recs)
+	}
+}
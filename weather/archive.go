@@ -0,0 +1,195 @@
+package weather
+
+import (
+	"math"
+	"time"
+)
+
+// ArchiveIntervals are the supported archive intervals, those of a Davis
+// console.
+var ArchiveIntervals = []time.Duration{
+	time.Minute, 5 * time.Minute, 10 * time.Minute,
+	15 * time.Minute, 30 * time.Minute, time.Hour,
+}
+
+// mean accumulates an average.
+type mean struct {
+	sum float64
+	n   int
+}
+
+func (m *mean) add(v float64) {
+	if !math.IsNaN(v) {
+		m.sum += v
+		m.n++
+	}
+}
+
+func (m mean) value() float64 {
+	if m.n == 0 {
+		return math.NaN()
+	}
+	return m.sum / float64(m.n)
+}
+
+// Archive summarizes the readings of an archive interval into a record.
+type Archive struct {
+	Interval time.Duration
+	Start    time.Time // start of the current interval
+
+	outTemp, outHumidity mean
+	outTempHL, outHumHL  HighLow
+	windSpeed            mean
+	windSectors          [16]int
+	windHigh             Extreme
+	windHighDir          float64
+	rain                 float64
+	rainKnown            bool
+	rainRate             HighLow
+	radiation, uv        mean
+	radiationHL, uvHL    HighLow
+	probes               map[string]*mean // leaf & soil probes by name
+}
+
+// NewArchive returns an archive with its first interval starting at start.
+func NewArchive(interval time.Duration, start time.Time) *Archive {
+	return &Archive{Interval: interval, Start: start}
+}
+
+// NextBoundary returns the first end of an interval after t. Intervals are
+// aligned to local midnight, so a 5 minute interval ends at 12:05, 12:10...
+func NextBoundary(t time.Time, interval time.Duration) time.Time {
+	y, m, d := t.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	n := t.Sub(midnight)/interval + 1
+	return midnight.Add(n * interval)
+}
+
+// Add adds a reading and the rain in mm it reports, that is the new bucket
+// tips. rain is NaN for readings without a known rain counter.
+func (a *Archive) Add(r Reading, rain float64) {
+	if !math.IsNaN(rain) {
+		a.rain += rain
+		a.rainKnown = true
+	}
+
+	for _, p := range r.Probes {
+		if a.probes == nil {
+			a.probes = make(map[string]*mean)
+		}
+		m := a.probes[p.Name()]
+		if m == nil {
+			m = new(mean)
+			a.probes[p.Name()] = m
+		}
+		m.add(p.Value)
+	}
+
+	if !r.NoWind {
+		a.windSpeed.add(r.WindSpeed)
+		if r.WindDirValid && r.WindSpeed > 0 {
+			a.windSectors[int(math.Mod(r.WindDir+11.25, 360)/22.5)]++
+		}
+		if a.windHigh.Time.IsZero() || r.WindSpeed > a.windHigh.Value {
+			a.windHigh = Extreme{r.WindSpeed, r.Time}
+			a.windHighDir = math.NaN()
+			if r.WindDirValid {
+				a.windHighDir = r.WindDir
+			}
+		}
+	}
+	if !r.Valid {
+		return
+	}
+	switch r.Kind {
+	case KindTemperature:
+		a.outTemp.add(r.Value)
+		a.outTempHL.update(r.Value, r.Time)
+	case KindHumidity:
+		a.outHumidity.add(r.Value)
+		a.outHumHL.update(r.Value, r.Time)
+	case KindGust:
+		// the gust packet has no direction of its own
+		if a.windHigh.Time.IsZero() || r.Value > a.windHigh.Value {
+			a.windHigh = Extreme{r.Value, r.Time}
+			a.windHighDir = math.NaN()
+		}
+	case KindRainRate:
+		a.rainRate.update(r.Value, r.Time)
+	case KindSolar:
+		a.radiation.add(r.Value)
+		a.radiationHL.update(r.Value, r.Time)
+	case KindUV:
+		a.uv.add(r.Value)
+		a.uvHL.update(r.Value, r.Time)
+	}
+}
+
+// dominantDir returns the center of the compass sector the wind blew from
+// most often, NaN when it was calm all the time.
+func (a *Archive) dominantDir() float64 {
+	best := -1
+	for i, n := range a.windSectors {
+		if n > 0 && (best < 0 || n > a.windSectors[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return math.NaN()
+	}
+	return float64(best) * 22.5
+}
+
+// Record returns the record of the interval ending at end by the names of
+// the weewx archive fields, leaving out what is unknown, and starts the next
+// interval.
+func (a *Archive) Record(end time.Time) map[string]float64 {
+	hl := func(h HighLow, high bool) float64 {
+		e := h.Low
+		if high {
+			e = h.High
+		}
+		if e.Time.IsZero() {
+			return math.NaN()
+		}
+		return e.Value
+	}
+	rain := math.NaN()
+	if a.rainKnown {
+		rain = a.rain
+	}
+	windGust, windGustDir := math.NaN(), math.NaN()
+	if !a.windHigh.Time.IsZero() {
+		windGust, windGustDir = a.windHigh.Value, a.windHighDir
+	}
+
+	values := make(map[string]float64)
+	for name, m := range a.probes {
+		values[name] = m.value()
+	}
+	for name, v := range map[string]float64{
+		"outTemp":         a.outTemp.value(),
+		"highOutTemp":     hl(a.outTempHL, true),
+		"lowOutTemp":      hl(a.outTempHL, false),
+		"outHumidity":     a.outHumidity.value(),
+		"highOutHumidity": hl(a.outHumHL, true),
+		"lowOutHumidity":  hl(a.outHumHL, false),
+		"windSpeed":       a.windSpeed.value(),
+		"windDir":         a.dominantDir(),
+		"windGust":        windGust,
+		"windGustDir":     windGustDir,
+		"rain":            rain,
+		"rainRate":        hl(a.rainRate, true),
+		"radiation":       a.radiation.value(),
+		"highRadiation":   hl(a.radiationHL, true),
+		"UV":              a.uv.value(),
+		"highUV":          hl(a.uvHL, true),
+	} {
+		if !math.IsNaN(v) {
+			values[name] = v
+		}
+	}
+
+	*a = Archive{Interval: a.Interval, Start: end}
+	return values
+}
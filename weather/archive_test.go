@@ -0,0 +1,68 @@
+package weather
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNextBoundary(t *testing.T) {
+	loc := time.FixedZone("IST", 5*3600+1800)
+	at := time.Date(2019, 3, 24, 12, 7, 30, 0, loc)
+	for _, c := range []struct {
+		interval time.Duration
+		want     time.Time
+	}{
+		{5 * time.Minute, time.Date(2019, 3, 24, 12, 10, 0, 0, loc)},
+		{time.Hour, time.Date(2019, 3, 24, 13, 0, 0, 0, loc)},
+	} {
+		if got := NextBoundary(at, c.interval); !got.Equal(c.want) {
+			t.Errorf("%s: got %s, want %s", c.interval, got, c.want)
+		}
+	}
+	// a boundary itself belongs to the interval before
+	if got, want := NextBoundary(time.Date(2019, 3, 24, 12, 10, 0, 0, loc), 5*time.Minute), time.Date(2019, 3, 24, 12, 15, 0, 0, loc); !got.Equal(want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestArchiveRecord(t *testing.T) {
+	start := time.Date(2019, 3, 24, 12, 0, 0, 0, time.UTC)
+	a := NewArchive(5*time.Minute, start)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+	nan := math.NaN()
+
+	a.Add(Reading{Time: at(10), WindSpeed: 2, WindDir: 90, WindDirValid: true, Kind: KindTemperature, Value: 10, Valid: true}, nan)
+	a.Add(Reading{Time: at(20), WindSpeed: 6, WindDir: 95, WindDirValid: true, Kind: KindTemperature, Value: 14, Valid: true}, nan)
+	a.Add(Reading{Time: at(30), WindSpeed: 4, WindDir: 270, WindDirValid: true, Kind: KindRain, Value: 5, Valid: true}, 0.4)
+	a.Add(Reading{Time: at(40), WindSpeed: 0, WindDir: 270, WindDirValid: true, Kind: KindGust, Value: 5, Valid: true}, nan)
+
+	rec := a.Record(start.Add(5 * time.Minute))
+	for _, c := range []struct {
+		name string
+		want float64
+	}{
+		{"outTemp", 12},
+		{"highOutTemp", 14},
+		{"lowOutTemp", 10},
+		{"windSpeed", 3},
+		{"windDir", 90},
+		{"windGust", 6},
+		{"windGustDir", 95},
+		{"rain", 0.4},
+	} {
+		if got, ok := rec[c.name]; !ok || got != c.want {
+			t.Errorf("%s: got %.2f (present %v), want %.2f", c.name, got, ok, c.want)
+		}
+	}
+	if _, ok := rec["outHumidity"]; ok {
+		t.Errorf("outHumidity without humidity readings")
+	}
+
+	if !a.Start.Equal(start.Add(5 * time.Minute)) {
+		t.Errorf("next interval starts %s", a.Start)
+	}
+	if rec := a.Record(start.Add(10 * time.Minute)); len(rec) != 0 {
+		t.Errorf("empty interval: got %v", rec)
+	}
+}
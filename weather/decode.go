@@ -0,0 +1,353 @@
+// Package weather decodes the sensor data in Davis packets and derives the
+// quantities a weather station console shows from it.
+package weather
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"config"
+)
+
+// Kind is the kind of sensor value a packet carries besides the wind.
+type Kind int
+
+const (
+	KindNone        Kind = iota
+	KindSupercap         // supercap voltage in V
+	KindUV               // UV index
+	KindRainRate         // rain rate in mm/h
+	KindSolar            // solar radiation in W/m²
+	KindSolarCell        // solar cell voltage in V
+	KindTemperature      // temperature in °C
+	KindGust             // 10-minute wind gust in m/s
+	KindHumidity         // relative humidity in %
+	KindRain             // rain bucket tip counter, 0-127
+
+	// values of the probes of a leaf & soil station, see Probe
+	KindSoilTemp     // soil temperature in °C
+	KindSoilMoisture // soil moisture tension in cb
+	KindLeafTemp     // leaf temperature in °C
+	KindLeafWetness  // leaf wetness, 0 (dry) to 15 (wet)
+)
+
+var kindNames = [...]string{"none", "supercap", "uv", "rain_rate", "solar", "solar_cell", "temperature", "gust", "humidity", "rain_counter",
+	"soil_temp", "soil_moisture", "leaf_temp", "leaf_wetness"}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+// Message types, the upper nibble of the first byte.
+const (
+	msgSupercap    = 0x2
+	msgUV          = 0x4
+	msgRainRate    = 0x5
+	msgSolar       = 0x6
+	msgSolarCell   = 0x7
+	msgTemperature = 0x8
+	msgGust        = 0x9
+	msgHumidity    = 0xA
+	msgRain        = 0xE
+	msgLeafSoil    = 0xF
+)
+
+const (
+	mphToMs = 0.44704
+
+	// Rain bucket sizes in mm.
+	Bucket001In = 0.254
+	Bucket02mm  = 0.2
+)
+
+// Options control decoding for one transmitter.
+type Options struct {
+	Bucket float64 // rain collected per bucket tip in mm
+	Type   string  // station type, config.Type*; empty for a Vantage Pro2 ISS
+
+	// DirOffset is added to the wind direction, in degrees.
+	DirOffset float64
+	// NoWind ignores the wind and the gusts, for an ISS whose wind is
+	// measured by an anemometer transmitter kit.
+	NoWind bool
+}
+
+// Probe is a value of an extra sensor: a probe of a leaf & soil station or
+// a temperature/humidity station.
+type Probe struct {
+	Kind  Kind
+	Port  int // probe port 1-4, or the Davis ID 1-8 of a temperature/humidity station
+	Value float64
+}
+
+// Name returns the weewx name of the value, e.g. soilMoist1.
+func (p Probe) Name() string {
+	var name string
+	switch p.Kind {
+	case KindSoilTemp:
+		name = "soilTemp"
+	case KindSoilMoisture:
+		name = "soilMoist"
+	case KindLeafTemp:
+		name = "leafTemp"
+	case KindLeafWetness:
+		name = "leafWet"
+	case KindTemperature:
+		name = "extraTemp"
+	case KindHumidity:
+		name = "extraHumid"
+	default:
+		name = p.Kind.String()
+	}
+	return fmt.Sprintf("%s%d", name, p.Port)
+}
+
+// Reading is the sensor data of one packet. Every packet of an ISS carries
+// the wind and one other sensor value. The packets of a leaf & soil station
+// carry the values of a probe instead, and the temperature and humidity of a
+// temperature/humidity station are extra sensors, not those of the station.
+type Reading struct {
+	Time       time.Time
+	ID         int
+	MsgType    byte
+	BatteryLow bool
+
+	WindSpeed    float64 // m/s
+	WindDir      float64 // degrees, 1-360
+	WindDirValid bool    // false without a wind vane
+	NoWind       bool    // the transmitter has no anemometer
+
+	Kind  Kind
+	Value float64 // in the unit of Kind
+	Valid bool    // false when the sensor is absent or reports no value
+
+	Probes []Probe // values of extra sensors, without absent ones
+}
+
+func (r Reading) String() string {
+	if r.NoWind {
+		s := fmt.Sprintf("{ID:%d", r.ID)
+		if r.Kind != KindNone {
+			s += fmt.Sprintf(" %s:", r.Kind)
+			if r.Valid {
+				s += fmt.Sprintf("%.2f", r.Value)
+			} else {
+				s += "-"
+			}
+		}
+		for _, p := range r.Probes {
+			s += fmt.Sprintf(" %s:%.2f", p.Name(), p.Value)
+		}
+		return s + "}"
+	}
+	if !r.Valid {
+		return fmt.Sprintf("{ID:%d Wind:%.1fm/s/%.0f° %s:-}", r.ID, r.WindSpeed, r.WindDir, r.Kind)
+	}
+	return fmt.Sprintf("{ID:%d Wind:%.1fm/s/%.0f° %s:%.2f}", r.ID, r.WindSpeed, r.WindDir, r.Kind, r.Value)
+}
+
+// Decode decodes the data of a Davis packet without the CRC, at least 6
+// bytes: header, wind speed, wind direction and three bytes of sensor data.
+func Decode(data []byte, t time.Time, opt Options) (r Reading) {
+	r.Time = t
+	if len(data) < 6 {
+		return r
+	}
+	r.ID = int(data[0] & 0x07)
+	r.MsgType = data[0] >> 4
+	r.BatteryLow = data[0]&0x08 != 0
+
+	if r.MsgType == msgLeafSoil || opt.Type == config.TypeLeafSoil {
+		r.NoWind = true
+		if r.MsgType == msgLeafSoil {
+			r.Probes = leafSoil(data)
+		}
+		return r
+	}
+	// the wind bytes of a temperature/humidity station are zero
+	r.NoWind = opt.NoWind || opt.Type == config.TypeTempHum
+	if !r.NoWind {
+		r.WindSpeed = float64(data[1]) * mphToMs
+		switch {
+		case opt.Type == config.TypeAuto:
+			// the direction depends on the model, so it is held until
+			// the model is known, see ModelDetector
+		case opt.Type == config.TypeVue:
+			// the Vue's vane covers the full circle in 256 steps
+			r.WindDir = float64(data[2])*1.40625 + 0.3
+			r.WindDirValid = true
+		case data[2] != 0:
+			// 0 is a Vantage Pro2 ISS without a vane
+			r.WindDir = 9 + float64(data[2])*342/255
+			r.WindDirValid = true
+		}
+		if r.WindDirValid {
+			r.WindDir = math.Mod(r.WindDir+opt.DirOffset+720, 360)
+			if r.WindDir == 0 {
+				r.WindDir = 360 // 0 is calm on a console
+			}
+		}
+	}
+
+	// A Vue encodes its sensors like a Vantage Pro2 ISS; it only never
+	// sends the UV and solar radiation messages, having no place for the
+	// sensors, which is how ModelDetector tells them apart.
+	b3, b4 := int(data[3]), int(data[4])
+	switch r.MsgType {
+	case msgSupercap:
+		r.Kind = KindSupercap
+		r.Value = float64(b3<<2|b4>>6) / 100
+		r.Valid = true
+	case msgUV:
+		r.Kind = KindUV
+		r.Value = float64((b3<<8|b4)>>6) / 50
+		r.Valid = b3 != 0xFF
+	case msgRainRate:
+		r.Kind = KindRainRate
+		r.Value, r.Valid = rainRate(b3, b4, opt.Bucket)
+	case msgSolar:
+		r.Kind = KindSolar
+		r.Value = float64((b3<<8|b4)>>6) * 1.757936
+		r.Valid = b3 != 0xFF
+	case msgSolarCell:
+		r.Kind = KindSolarCell
+		r.Value = float64(b3<<2|b4>>6) / 300
+		r.Valid = true
+	case msgTemperature:
+		r.Kind = KindTemperature
+		tenthF := int16(uint16(b3)<<8|uint16(b4)) >> 4
+		r.Value = FahrenheitToCelsius(float64(tenthF) / 10)
+		r.Valid = !(b3 == 0xFF && b4&0xF0 == 0xC0)
+	case msgGust:
+		r.Kind = KindGust
+		r.Value = float64(b3) * mphToMs
+		r.Valid = true
+	case msgHumidity:
+		r.Kind = KindHumidity
+		r.Value = float64((b4>>4)<<8|b3) / 10
+		r.Valid = r.Value > 0 && r.Value <= 100
+	case msgRain:
+		r.Kind = KindRain
+		r.Value = float64(b3 & 0x7F)
+		r.Valid = b3 != 0x80
+	}
+	switch {
+	case r.Kind == KindGust && r.NoWind:
+		r.Kind, r.Value, r.Valid = KindNone, 0, false
+	case opt.Type == config.TypeAnemometer && r.Kind != KindGust:
+		// the kit's wind is all the station gets from it
+		r.Kind, r.Value, r.Valid = KindNone, 0, false
+	}
+	if opt.Type == config.TypeTempHum {
+		// only temperature and humidity are of interest; the station
+		// has no rain collector or light sensors
+		if r.Valid && (r.Kind == KindTemperature || r.Kind == KindHumidity) {
+			r.Probes = []Probe{{r.Kind, r.ID + 1, r.Value}}
+		}
+		r.Kind, r.Value, r.Valid = KindNone, 0, false
+	}
+	return r
+}
+
+// rainRate decodes the time between the last two bucket tips into a rain
+// rate in mm/h.
+func rainRate(b3, b4 int, bucket float64) (rate float64, valid bool) {
+	if b3 == 0xFF {
+		return 0, true // no rain
+	}
+	tips := (b4&0x30)<<4 | b3
+	if tips == 0 {
+		return 0, false
+	}
+	seconds := float64(tips)
+	if b4&0x40 == 0 {
+		seconds /= 16 // heavy rain: 1/16 second resolution
+	}
+	return 3600 / seconds * bucket, true
+}
+
+// leafSoil decodes the packet of a leaf & soil station. The second byte has
+// the kind of probe in its low bits and the port in its high bits. The
+// moisture or wetness and the temperature are 10-bit readings of voltage
+// dividers, 0x3FF when no probe is connected.
+func leafSoil(data []byte) (probes []Probe) {
+	port := int(data[1]>>5) & 0x7
+	if port < 1 || port > 4 {
+		return nil
+	}
+	value := int(data[2])<<2 | int(data[4])>>6
+	temp := int(data[3])<<2 | int(data[5])>>6
+	tempKind, valueKind := KindSoilTemp, KindSoilMoisture
+	switch data[1] & 0x3 {
+	case 1:
+	case 2:
+		tempKind, valueKind = KindLeafTemp, KindLeafWetness
+	default:
+		return nil
+	}
+
+	t := math.NaN()
+	if temp != 0x3FF && temp != 0 {
+		t = probeTemperature(temp)
+		probes = append(probes, Probe{tempKind, port, t})
+	}
+	if value != 0x3FF {
+		if valueKind == KindSoilMoisture {
+			probes = append(probes, Probe{valueKind, port, soilMoisture(value, t)})
+		} else {
+			probes = append(probes, Probe{valueKind, port, leafWetness(value)})
+		}
+	}
+	return probes
+}
+
+// probeResistance returns the resistance in kΩ of a probe from the reading
+// of its voltage divider.
+func probeResistance(raw int) float64 {
+	return 18.81099 / (1/float64(raw) - 0.0009988027) / 1000
+}
+
+// probeTemperature returns the temperature in °C of the thermistor of a
+// probe, with the Steinhart-Hart coefficients of the Davis probes.
+func probeTemperature(raw int) float64 {
+	r := probeResistance(raw)
+	return 1/(0.002783573+0.0002509406*math.Log(r)) - 273
+}
+
+// soilMoisture returns the soil moisture tension in cb of a Watermark
+// sensor from its reading, corrected for the soil temperature t in °C,
+// 24°C when it is not known.
+func soilMoisture(raw int, t float64) float64 {
+	if math.IsNaN(t) {
+		t = 24
+	}
+	r := probeResistance(raw)
+	if r < 1 {
+		return 0 // saturated
+	}
+	cb := (4.093 + 3.213*r) / (1 - 0.009733*r - 0.01205*t)
+	if cb < 0 || cb > 200 {
+		cb = 200
+	}
+	return math.Floor(cb + 0.5)
+}
+
+// leafWetness returns the leaf wetness on the scale of the console, 0 for
+// a dry and 15 for a wet leaf. The sensor grid conducts when it is wet.
+func leafWetness(raw int) float64 {
+	return math.Floor(15*(1-float64(raw)/1023) + 0.5)
+}
+
+// FahrenheitToCelsius converts °F to °C.
+func FahrenheitToCelsius(f float64) float64 {
+	return (f - 32) * 5 / 9
+}
+
+// CelsiusToFahrenheit converts °C to °F.
+func CelsiusToFahrenheit(c float64) float64 {
+	return c*9/5 + 32
+}
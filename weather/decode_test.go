@@ -0,0 +1,195 @@
+package weather
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	for _, tc := range []struct {
+		data  []byte
+		kind  Kind
+		value float64
+		valid bool
+	}{
+		{[]byte{0x80, 0x05, 0x80, 0x02, 0xBC, 0x00}, KindTemperature, FahrenheitToCelsius(4.3), true},
+		{[]byte{0x80, 0x05, 0x80, 0x0F, 0x99, 0x00}, KindTemperature, FahrenheitToCelsius(24.9), true},
+		{[]byte{0x80, 0x05, 0x80, 0xFF, 0x81, 0x00}, KindTemperature, FahrenheitToCelsius(-0.8), true},
+		{[]byte{0x80, 0x05, 0x80, 0xFF, 0xC1, 0x00}, KindTemperature, FahrenheitToCelsius(-0.4), false},
+		{[]byte{0xA0, 0x05, 0x80, 0x5E, 0x20, 0x00}, KindHumidity, 60.6, true},
+		{[]byte{0xE0, 0x05, 0x80, 0x85, 0x00, 0x00}, KindRain, 5, true},
+		{[]byte{0xE0, 0x05, 0x80, 0x80, 0x00, 0x00}, KindRain, 0, false},
+		{[]byte{0x50, 0x05, 0x80, 0xFF, 0x71, 0x00}, KindRainRate, 0, true},
+		{[]byte{0x50, 0x05, 0x80, 0x48, 0x41, 0x00}, KindRainRate, 3600.0 / 72 * Bucket02mm, true},
+		{[]byte{0x50, 0x05, 0x80, 0x48, 0x01, 0x00}, KindRainRate, 3600.0 / 4.5 * Bucket02mm, true},
+		{[]byte{0x60, 0x05, 0x80, 0x1C, 0xC0, 0x00}, KindSolar, 115 * 1.757936, true},
+		{[]byte{0x60, 0x05, 0x80, 0xFF, 0xC5, 0x00}, KindSolar, 1023 * 1.757936, false},
+		{[]byte{0x40, 0x05, 0x80, 0x02, 0x80, 0x00}, KindUV, 0.2, true},
+		{[]byte{0x20, 0x05, 0x80, 0x9C, 0x40, 0x00}, KindSupercap, 6.25, true},
+		{[]byte{0x70, 0x05, 0x80, 0xE1, 0x00, 0x00}, KindSolarCell, 3.0, true},
+		{[]byte{0x90, 0x05, 0x80, 0x0A, 0x00, 0x00}, KindGust, 10 * mphToMs, true},
+	} {
+		r := Decode(tc.data, time.Time{}, Options{Bucket: Bucket02mm})
+		if r.Kind != tc.kind || r.Valid != tc.valid || math.Abs(r.Value-tc.value) > 1e-9 {
+			t.Errorf("%02X: got %s %.4f %v, want %s %.4f %v", tc.data, r.Kind, r.Value, r.Valid, tc.kind, tc.value, tc.valid)
+		}
+	}
+}
+
+func TestDecodeHeader(t *testing.T) {
+	r := Decode([]byte{0x8D, 0x0A, 0xFF, 0x02, 0xBC, 0x00}, time.Time{}, Options{})
+	if r.ID != 5 || r.MsgType != 0x8 || !r.BatteryLow {
+		t.Errorf("header: got ID %d type %X battery %v", r.ID, r.MsgType, r.BatteryLow)
+	}
+	if math.Abs(r.WindSpeed-4.4704) > 1e-9 || r.WindDir != 351 || !r.WindDirValid {
+		t.Errorf("wind: got %.4f m/s %.1f°", r.WindSpeed, r.WindDir)
+	}
+	if r := Decode([]byte{0x80, 0x00, 0x00, 0x02, 0xBC, 0x00}, time.Time{}, Options{}); r.WindDirValid {
+		t.Errorf("wind direction without vane is valid")
+	}
+}
+
+func TestDecodeLeafSoil(t *testing.T) {
+	// soil probe on port 1 at about 25°C, moisture reading 400
+	r := Decode([]byte{0xF2, 0x21, 0x64, 0x55, 0x00, 0x80}, time.Time{}, Options{})
+	if r.ID != 2 || !r.NoWind || r.Kind != KindNone || len(r.Probes) != 2 {
+		t.Fatalf("got %s", r)
+	}
+	temp, moist := r.Probes[0], r.Probes[1]
+	if temp.Name() != "soilTemp1" || math.Abs(temp.Value-25) > 0.5 {
+		t.Errorf("temperature: got %s %.2f", temp.Name(), temp.Value)
+	}
+	if moist.Name() != "soilMoist1" || moist.Value != soilMoisture(400, temp.Value) || moist.Value <= 0 || moist.Value >= 200 {
+		t.Errorf("moisture: got %s %.2f", moist.Name(), moist.Value)
+	}
+
+	// leaf probe on port 2 without a thermistor
+	r = Decode([]byte{0xF2, 0x42, 0x00, 0xFF, 0x00, 0xC0}, time.Time{}, Options{})
+	if len(r.Probes) != 1 || r.Probes[0].Name() != "leafWet2" || r.Probes[0].Value != 15 {
+		t.Errorf("leaf: got %s", r)
+	}
+
+	// a declared leaf & soil station has no wind
+	r = Decode([]byte{0x82, 0x05, 0x80, 0x02, 0xBC, 0x00}, time.Time{}, Options{Type: "leafsoil"})
+	if !r.NoWind || r.Kind != KindNone {
+		t.Errorf("leafsoil type: got %s", r)
+	}
+}
+
+func TestStationProbes(t *testing.T) {
+	now := time.Date(2019, 3, 24, 12, 0, 0, 0, time.UTC)
+	s := NewStation(Bucket02mm)
+	s.Update(Decode([]byte{0x80, 0x05, 0x80, 0x02, 0xBC, 0x00}, now, Options{}))
+	s.Update(Decode([]byte{0xF2, 0x21, 0x64, 0x55, 0x00, 0x80}, now.Add(time.Second), Options{}))
+	v := s.Conditions(now.Add(2 * time.Second)).Values()
+	if _, ok := v["soilTemp1"]; !ok {
+		t.Errorf("no soilTemp1 in %v", v)
+	}
+	if v["windSpeed"] != 5*mphToMs {
+		t.Errorf("wind speed: got %.2f, want the ISS's", v["windSpeed"])
+	}
+}
+
+func TestDecodeTempHum(t *testing.T) {
+	opt := Options{Type: "temphum"}
+	r := Decode([]byte{0x82, 0x00, 0x00, 0x02, 0xBC, 0x00}, time.Time{}, opt)
+	if !r.NoWind || r.Kind != KindNone || len(r.Probes) != 1 {
+		t.Fatalf("temperature: got %s", r)
+	}
+	if p := r.Probes[0]; p.Name() != "extraTemp3" || math.Abs(p.Value-FahrenheitToCelsius(4.3)) > 1e-9 {
+		t.Errorf("temperature: got %s %.2f", p.Name(), p.Value)
+	}
+	r = Decode([]byte{0xA2, 0x00, 0x00, 0x5E, 0x20, 0x00}, time.Time{}, opt)
+	if len(r.Probes) != 1 || r.Probes[0].Name() != "extraHumid3" || r.Probes[0].Value != 60.6 {
+		t.Errorf("humidity: got %s", r)
+	}
+	if r := Decode([]byte{0xE2, 0x00, 0x00, 0x85, 0x00, 0x00}, time.Time{}, opt); r.Kind != KindNone || len(r.Probes) != 0 {
+		t.Errorf("rain: got %s", r)
+	}
+}
+
+func TestDecodeWind(t *testing.T) {
+	// anemometer kit with its vane 20° off
+	r := Decode([]byte{0x91, 0x05, 0x80, 0x0A, 0x00, 0x00}, time.Time{}, Options{Type: "anemometer", DirOffset: -20})
+	if r.WindSpeed != 5*mphToMs || math.Abs(r.WindDir-(9+128.0*342/255-20)) > 1e-9 || r.Kind != KindGust {
+		t.Errorf("anemometer: got %s", r)
+	}
+	if r := Decode([]byte{0x81, 0x05, 0x01, 0x02, 0xBC, 0x00}, time.Time{}, Options{Type: "anemometer", DirOffset: -20}); r.Kind != KindNone || r.WindDir <= 300 {
+		t.Errorf("anemometer temperature: got %s", r)
+	}
+	// the ISS of a station with an anemometer kit
+	r = Decode([]byte{0x90, 0x05, 0x80, 0x0A, 0x00, 0x00}, time.Time{}, Options{NoWind: true})
+	if !r.NoWind || r.Kind != KindNone {
+		t.Errorf("ISS gust: got %s", r)
+	}
+	r = Decode([]byte{0x80, 0x05, 0x80, 0x02, 0xBC, 0x00}, time.Time{}, Options{NoWind: true})
+	if !r.NoWind || r.Kind != KindTemperature {
+		t.Errorf("ISS temperature: got %s", r)
+	}
+}
+
+func TestDecodeModels(t *testing.T) {
+	for _, tc := range []struct {
+		typ  string
+		dir  byte
+		want float64
+	}{
+		{"iss", 0x01, 9 + 342.0/255},
+		{"iss", 0x80, 9 + 128*342.0/255},
+		{"iss", 0xFF, 351},
+		{"vue", 0x00, 0.3},
+		{"vue", 0x80, 180.3},
+		{"vue", 0xFF, 358.894},
+	} {
+		r := Decode([]byte{0x80, 0x05, tc.dir, 0x02, 0xBC, 0x00}, time.Time{}, Options{Type: tc.typ})
+		if !r.WindDirValid || math.Abs(r.WindDir-tc.want) > 0.001 {
+			t.Errorf("%s %02X: got %.3f°, want %.3f°", tc.typ, tc.dir, r.WindDir, tc.want)
+		}
+	}
+}
+
+func TestDecodeAuto(t *testing.T) {
+	// until the model is known the direction is held, the rest decoded
+	r := Decode([]byte{0x80, 0x05, 0x00, 0x02, 0xBC, 0x00}, time.Time{}, Options{Type: "auto"})
+	if r.WindDirValid || r.WindSpeed != 5*mphToMs || r.Kind != KindTemperature || !r.Valid {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestDecodeVueSensors(t *testing.T) {
+	// the sensor bytes of a Vue mean the same as those of a Vantage Pro2
+	for _, data := range [][]byte{
+		{0x20, 0x05, 0x80, 0x9C, 0x40, 0x00}, // supercap
+		{0x50, 0x05, 0x80, 0x30, 0x20, 0x00}, // rain rate
+		{0x70, 0x05, 0x80, 0x9C, 0x40, 0x00}, // solar cell
+		{0x80, 0x05, 0x80, 0x02, 0xBC, 0x00}, // temperature
+		{0x90, 0x05, 0x80, 0x0C, 0x20, 0x00}, // gust
+		{0xA0, 0x05, 0x80, 0x5A, 0x20, 0x00}, // humidity
+		{0xE0, 0x05, 0x80, 0x12, 0x00, 0x00}, // rain
+	} {
+		vp2 := Decode(data, time.Time{}, Options{Type: "iss", Bucket: 0.2})
+		vue := Decode(data, time.Time{}, Options{Type: "vue", Bucket: 0.2})
+		if vue.Kind != vp2.Kind || vue.Value != vp2.Value || vue.Valid != vp2.Valid || vue.Kind == KindNone {
+			t.Errorf("%02X: Vue %v, Vantage Pro2 %v", data, vue, vp2)
+		}
+	}
+}
+
+func TestModelDetector(t *testing.T) {
+	var vue, vp2 ModelDetector
+	vue.Add([]byte{0x80})
+	if m := vue.Model(); m != "" {
+		t.Errorf("after one packet: got %q", m)
+	}
+	for i := 1; i < modelPackets; i++ {
+		vue.Add([]byte{0x20, 0x80, 0x70, 0xA0, 0x90}[i%5 : i%5+1])
+		vp2.Add([]byte{0x80, 0x20, 0x60, 0xA0, 0x40}[i%5 : i%5+1])
+	}
+	if m := vue.Model(); m != "vue" {
+		t.Errorf("Vue: got %q", m)
+	}
+	if m := vp2.Model(); m != "iss" {
+		t.Errorf("Vantage Pro2: got %q", m)
+	}
+}
@@ -0,0 +1,117 @@
+package weather
+
+import (
+	"math"
+	"time"
+)
+
+// DewPoint returns the dew point in °C for a temperature in °C and a
+// relative humidity in %, using the Magnus formula.
+func DewPoint(tC, rh float64) float64 {
+	const a, b = 17.62, 243.12
+	g := math.Log(rh/100) + a*tC/(b+tC)
+	return b * g / (a - g)
+}
+
+// HeatIndex returns the heat index in °C, following the algorithm of the
+// US National Weather Service.
+func HeatIndex(tC, rh float64) float64 {
+	t := CelsiusToFahrenheit(tC)
+	hi := 0.5 * (t + 61 + (t-68)*1.2 + rh*0.094)
+	if (hi+t)/2 < 80 {
+		return FahrenheitToCelsius(hi)
+	}
+
+	hi = -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh -
+		0.00683783*t*t - 0.05481717*rh*rh + 0.00122874*t*t*rh +
+		0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+	if rh < 13 && t >= 80 && t <= 112 {
+		hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+	} else if rh > 85 && t >= 80 && t <= 87 {
+		hi += (rh - 85) / 10 * (87 - t) / 5
+	}
+	return FahrenheitToCelsius(hi)
+}
+
+// WindChill returns the wind chill in °C for a temperature in °C and a
+// wind speed in m/s, using the 2001 formula of the US National Weather
+// Service. Outside its range (above 10 °C or below 1.3 m/s) it returns
+// the temperature.
+func WindChill(tC, wind float64) float64 {
+	t := CelsiusToFahrenheit(tC)
+	v := wind / mphToMs
+	if t > 50 || v < 3 {
+		return tC
+	}
+	v16 := math.Pow(v, 0.16)
+	return FahrenheitToCelsius(35.74 + 0.6215*t - 35.75*v16 + 0.4275*t*v16)
+}
+
+// vapourPressure returns the water vapour pressure in hPa.
+func vapourPressure(tC, rh float64) float64 {
+	return rh / 100 * 6.105 * math.Exp(17.27*tC/(237.7+tC))
+}
+
+// ApparentTemperature returns the apparent temperature in °C in the shade,
+// as used by the Australian Bureau of Meteorology (Steadman, 1994).
+func ApparentTemperature(tC, rh, wind float64) float64 {
+	return tC + 0.33*vapourPressure(tC, rh) - 0.70*wind - 4.00
+}
+
+// THSW returns the Temperature-Humidity-Sun-Wind index in °C: the apparent
+// temperature including the heating by the sun. Davis does not publish its
+// formula; this is Steadman's apparent temperature with radiation, assuming
+// a person absorbs 15% of the solar radiation.
+func THSW(tC, rh, wind, solar float64) float64 {
+	q := 0.15 * solar
+	return tC + 0.348*vapourPressure(tC, rh) - 0.70*wind + 0.70*q/(wind+10) - 4.25
+}
+
+// ET returns the reference evapotranspiration in mm/h using the FAO-56
+// Penman-Monteith equation for hourly steps. The air pressure is derived
+// from the altitude in m, so no barometer is needed. The wind speed in m/s
+// is taken as measured at 2 m; lat and lon are in degrees, east and north
+// positive.
+func ET(tC, rh, wind, solar float64, t time.Time, lat, lon, alt float64) float64 {
+	p := 101.3 * math.Pow((293-0.0065*alt)/293, 5.26) // kPa
+	gamma := 0.000665 * p
+	es := 0.6108 * math.Exp(17.27*tC/(tC+237.3))
+	ea := es * rh / 100
+	delta := 4098 * es / ((tC + 237.3) * (tC + 237.3))
+
+	rs := solar * 0.0036 // MJ/m²/h
+	rso := (0.75 + 2e-5*alt) * extraterrestrial(t, lat, lon)
+	ratio := 0.5 // at night, when Rs/Rso is unknown
+	if rso > 0 {
+		ratio = math.Max(0.3, math.Min(1, rs/rso))
+	}
+	tk := tC + 273.16
+	rnl := 2.043e-10 * tk * tk * tk * tk * (0.34 - 0.14*math.Sqrt(ea)) * (1.35*ratio - 0.35)
+	rn := 0.77*rs - rnl
+	g := 0.5 * rn
+	if rs > 0 {
+		g = 0.1 * rn
+	}
+
+	et := (0.408*delta*(rn-g) + gamma*37/(tC+273)*wind*(es-ea)) / (delta + gamma*(1+0.34*wind))
+	return math.Max(0, et)
+}
+
+// extraterrestrial returns the extraterrestrial radiation in MJ/m² for the
+// hour around t (FAO-56 equation 28).
+func extraterrestrial(t time.Time, lat, lon float64) float64 {
+	t = t.UTC()
+	j := float64(t.YearDay())
+	dr := 1 + 0.033*math.Cos(2*math.Pi*j/365)
+	decl := 0.409 * math.Sin(2*math.Pi*j/365-1.39)
+	b := 2 * math.Pi * (j - 81) / 364
+	sc := 0.1645*math.Sin(2*b) - 0.1255*math.Cos(b) - 0.025*math.Sin(b)
+	hour := float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+	omega := math.Pi / 12 * (hour + lon/15 + sc - 12)
+	w1, w2 := omega-math.Pi/24, omega+math.Pi/24
+
+	phi := lat * math.Pi / 180
+	ra := 12 * 60 / math.Pi * 0.0820 * dr *
+		((w2-w1)*math.Sin(phi)*math.Sin(decl) + math.Cos(phi)*math.Cos(decl)*(math.Sin(w2)-math.Sin(w1)))
+	return math.Max(0, ra)
+}
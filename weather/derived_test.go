@@ -0,0 +1,46 @@
+package weather
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDerived(t *testing.T) {
+	f := FahrenheitToCelsius
+	for _, c := range []struct {
+		name      string
+		got, want float64
+		tolerance float64
+	}{
+		{"dew point", DewPoint(20, 50), 9.26, 0.01},
+		{"dew point saturated", DewPoint(10, 100), 10, 1e-9},
+		{"heat index 90F 70%", HeatIndex(f(90), 70), f(105.9), 0.1},
+		{"heat index 80F 90%", HeatIndex(f(80), 90), f(86), 0.3},
+		{"heat index mild", HeatIndex(f(70), 50), f(69.05), 0.01},
+		{"wind chill 0F 15mph", WindChill(f(0), 15*mphToMs), f(-19.4), 0.1},
+		{"wind chill calm", WindChill(-5, 1), -5, 1e-9},
+		{"wind chill warm", WindChill(15, 10), 15, 1e-9},
+		{"apparent temperature", ApparentTemperature(25, 50, 2), 24.82, 0.01},
+		{"THSW in the shade", THSW(25, 50, 2, 0), 25 + 0.348*vapourPressure(25, 50) - 1.4 - 4.25, 1e-9},
+		{"THSW in the sun", THSW(25, 50, 2, 800) - THSW(25, 50, 2, 0), 7, 1e-9},
+	} {
+		if math.Abs(c.got-c.want) > c.tolerance {
+			t.Errorf("%s: got %.3f, want %.3f", c.name, c.got, c.want)
+		}
+	}
+}
+
+// FAO-56 example 19: N'Diaye, Senegal, 1 October 14:00-15:00 local time
+// (UTC-1 for the FAO example), ET0 = 0.63 mm/h.
+func TestET(t *testing.T) {
+	at := time.Date(2019, 10, 1, 15, 30, 0, 0, time.UTC)
+	et := ET(38, 52, 3.3, 2.450/0.0036, at, 16+13.0/60, -(16 + 15.0/60), 8)
+	if math.Abs(et-0.63) > 0.02 {
+		t.Errorf("ET: got %.3f mm/h, want 0.63", et)
+	}
+	night := time.Date(2019, 10, 1, 2, 30, 0, 0, time.UTC)
+	if et := ET(28, 90, 1.9, 0, night, 16+13.0/60, -(16 + 15.0/60), 8); et > 0.02 {
+		t.Errorf("ET at night: got %.3f mm/h, want 0.00", et)
+	}
+}
@@ -0,0 +1,105 @@
+package weather
+
+import (
+	"time"
+)
+
+// Health event types.
+const (
+	EventBatteryLow      = "battery_low"      // the battery flag was set
+	EventBatteryOK       = "battery_ok"       // the battery flag was cleared
+	EventSupercapFalling = "supercap_falling" // the daily supercap minimum keeps falling
+)
+
+const (
+	healthDays   = 7    // daily supercap minima kept
+	fallingDays  = 3    // days the minimum must fall in a row
+	supercapDrop = 0.02 // V the minimum must fall by in a day
+)
+
+// HealthEvent is a change in the health of a transmitter.
+type HealthEvent struct {
+	Time  time.Time
+	ID    int
+	Type  string  // Event*
+	Value float64 // the last daily supercap minimum of EventSupercapFalling
+}
+
+// DailyMin is the lowest supercap voltage of a day.
+type DailyMin struct {
+	Day   string // YYYY-MM-DD in local time
+	Value float64
+}
+
+// Health is the battery and supercap health of a transmitter.
+//
+// The supercap of an ISS is charged by its solar cell by day and feeds the
+// ISS at night, so its voltage follows the sun. Its daily minimum is what
+// tells the trend: when the minimum falls day after day the solar cell no
+// longer keeps up, and the battery is about to take over.
+type Health struct {
+	BatteryLow   bool
+	BatterySince time.Time  // when the battery flag was set
+	Supercap     float64    // last supercap voltage, 0 when not known
+	SolarCell    float64    // last solar cell voltage, 0 when not known
+	Minima       []DailyMin // of the supercap voltage, oldest first
+	Falling      bool       // the minimum is falling and was reported
+}
+
+// Update processes a reading of the transmitter and returns the events it
+// causes.
+func (h *Health) Update(r Reading) (events []HealthEvent) {
+	switch {
+	case r.BatteryLow && !h.BatteryLow:
+		h.BatteryLow, h.BatterySince = true, r.Time
+		events = append(events, HealthEvent{r.Time, r.ID, EventBatteryLow, 0})
+	case !r.BatteryLow && h.BatteryLow:
+		h.BatteryLow, h.BatterySince = false, time.Time{}
+		events = append(events, HealthEvent{r.Time, r.ID, EventBatteryOK, 0})
+	}
+	if !r.Valid {
+		return events
+	}
+	switch r.Kind {
+	case KindSolarCell:
+		h.SolarCell = r.Value
+	case KindSupercap:
+		h.Supercap = r.Value
+		day := r.Time.Format("2006-01-02")
+		if n := len(h.Minima); n > 0 && h.Minima[n-1].Day == day {
+			if r.Value < h.Minima[n-1].Value {
+				h.Minima[n-1].Value = r.Value
+			}
+			break
+		}
+		// a new day completes the previous one
+		if h.falling() {
+			if !h.Falling {
+				h.Falling = true
+				events = append(events, HealthEvent{r.Time, r.ID, EventSupercapFalling, h.Minima[len(h.Minima)-1].Value})
+			}
+		} else if n := len(h.Minima); n > 1 && h.Minima[n-1].Value >= h.Minima[n-2].Value {
+			h.Falling = false
+		}
+		h.Minima = append(h.Minima, DailyMin{day, r.Value})
+		if len(h.Minima) > healthDays {
+			h.Minima = h.Minima[len(h.Minima)-healthDays:]
+		}
+	}
+	return events
+}
+
+// falling tells whether the daily minimum fell by supercapDrop or more on
+// each of the last fallingDays days.
+func (h *Health) falling() bool {
+	n := len(h.Minima)
+	if n <= fallingDays {
+		return false
+	}
+	for i := n - fallingDays; i < n; i++ {
+		if h.Minima[i-1].Value-h.Minima[i].Value < supercapDrop {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package weather
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthBattery(t *testing.T) {
+	var h Health
+	at := time.Date(2019, 3, 24, 12, 0, 0, 0, time.UTC)
+	if ev := h.Update(Reading{Time: at, ID: 1}); len(ev) != 0 {
+		t.Errorf("battery ok: got %v", ev)
+	}
+	ev := h.Update(Reading{Time: at.Add(time.Minute), ID: 1, BatteryLow: true})
+	if len(ev) != 1 || ev[0].Type != EventBatteryLow || ev[0].ID != 1 || !h.BatterySince.Equal(at.Add(time.Minute)) {
+		t.Errorf("battery low: got %v", ev)
+	}
+	if ev := h.Update(Reading{Time: at.Add(2 * time.Minute), ID: 1, BatteryLow: true}); len(ev) != 0 {
+		t.Errorf("still low: got %v", ev)
+	}
+	if ev := h.Update(Reading{Time: at.Add(3 * time.Minute), ID: 1}); len(ev) != 1 || ev[0].Type != EventBatteryOK {
+		t.Errorf("battery replaced: got %v", ev)
+	}
+}
+
+func TestHealthSupercap(t *testing.T) {
+	var h Health
+	start := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+	supercap := func(day int, hour int, v float64) []HealthEvent {
+		at := start.Add(time.Duration(day)*24*time.Hour + time.Duration(hour)*time.Hour)
+		return h.Update(Reading{Time: at, Kind: KindSupercap, Value: v, Valid: true})
+	}
+	// charged by day, a steady minimum at night
+	for day := 0; day < 3; day++ {
+		for _, ev := range [][]HealthEvent{supercap(day, 5, 2.60), supercap(day, 14, 3.30)} {
+			if len(ev) != 0 {
+				t.Errorf("day %d: got %v", day, ev)
+			}
+		}
+	}
+	// the nights get lower
+	var events []HealthEvent
+	for day := 3; day < 8; day++ {
+		events = append(events, supercap(day, 5, 2.60-0.05*float64(day-2))...)
+		events = append(events, supercap(day, 14, 3.0)...)
+	}
+	if len(events) != 1 || events[0].Type != EventSupercapFalling || events[0].Value != 2.60-0.05*3 {
+		t.Errorf("falling: got %v", events)
+	}
+	if len(h.Minima) != healthDays || h.Supercap != 3.0 {
+		t.Errorf("got %d minima, supercap %.2f", len(h.Minima), h.Supercap)
+	}
+
+	// recovered
+	supercap(8, 5, 2.5)
+	supercap(9, 5, 2.5)
+	if h.Falling {
+		t.Errorf("still falling after the minimum rose")
+	}
+}
@@ -0,0 +1,41 @@
+package weather
+
+import (
+	"config"
+)
+
+// modelPackets is the number of packets after which an ISS which sent no
+// UV or solar radiation message is taken for a Vue: a Vantage Pro2 ISS
+// sends each of them every 20 packets, with or without the sensor.
+const modelPackets = 40
+
+// ModelDetector tells a Vantage Pro2 from a Vantage Vue ISS by the mix of
+// message types it sends.
+type ModelDetector struct {
+	packets int
+	vp2     bool
+}
+
+// Add counts the packet with the given data.
+func (d *ModelDetector) Add(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	d.packets++
+	switch data[0] >> 4 {
+	case msgUV, msgSolar:
+		d.vp2 = true
+	}
+}
+
+// Model returns config.TypeISS or config.TypeVue, or "" while the model is
+// not known yet.
+func (d *ModelDetector) Model() string {
+	switch {
+	case d.vp2:
+		return config.TypeISS
+	case d.packets >= modelPackets:
+		return config.TypeVue
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package weather
+
+import (
+	"time"
+)
+
+const (
+	rainHistory = 24 * time.Hour // tips are kept this long for the totals
+	stormDry    = 24 * time.Hour // a storm ends after this long without rain
+)
+
+// Tip is a number of bucket tips seen at one time.
+type Tip struct {
+	Time  time.Time
+	Count int
+}
+
+// Rain accumulates the rain of one transmitter from the 7-bit rolling
+// bucket tip counter in its rain packets. Its exported fields are the state
+// to save across restarts, so the tips while we were gone are counted too.
+type Rain struct {
+	Counter    int       // last counter value; -1 = unknown
+	Tips       []Tip     // tips of the last 24 hours
+	Day        string    // local date DayTotal belongs to, YYYY-MM-DD
+	DayTotal   int       // tips since midnight
+	StormStart time.Time // zero when there is no storm
+	StormTotal int       // tips since the start of the storm
+	LastTip    time.Time
+}
+
+// NewRain returns a Rain without a known counter.
+func NewRain() Rain {
+	return Rain{Counter: -1}
+}
+
+// Update processes a counter value received at t and returns the number of
+// new bucket tips. The counter rolls over at 128; as long as fewer tips
+// fall between two received rain packets, missed packets and restarts of
+// the receiver do not lose rain.
+func (r *Rain) Update(t time.Time, counter int) (tips int) {
+	counter &= 0x7F
+	r.expire(t)
+	if r.Counter < 0 {
+		r.Counter = counter
+		return 0
+	}
+	tips = (counter - r.Counter + 128) % 128
+	r.Counter = counter
+	if tips == 0 {
+		return 0
+	}
+
+	r.Tips = append(r.Tips, Tip{t, tips})
+	r.DayTotal += tips
+	if r.StormStart.IsZero() {
+		r.StormStart = t
+	}
+	r.StormTotal += tips
+	r.LastTip = t
+	return tips
+}
+
+// expire drops what is no longer part of the totals at t.
+func (r *Rain) expire(t time.Time) {
+	if day := t.Format("2006-01-02"); day != r.Day {
+		r.Day = day
+		r.DayTotal = 0
+	}
+	if !r.StormStart.IsZero() && t.Sub(r.LastTip) >= stormDry {
+		r.StormStart = time.Time{}
+		r.StormTotal = 0
+	}
+	n := 0
+	for n < len(r.Tips) && t.Sub(r.Tips[n].Time) >= rainHistory {
+		n++
+	}
+	r.Tips = r.Tips[n:]
+}
+
+// Since returns the number of tips after t-d up to t.
+func (r *Rain) Since(t time.Time, d time.Duration) (tips int) {
+	for _, tip := range r.Tips {
+		if age := t.Sub(tip.Time); age < d && age >= 0 {
+			tips += tip.Count
+		}
+	}
+	return tips
+}
+
+// Totals is the rain in mm over the usual periods.
+type Totals struct {
+	Day        float64 // since local midnight
+	Hour       float64 // last hour
+	Day24      float64 // last 24 hours
+	Storm      float64 // since the start of the storm, 0 without one
+	StormStart time.Time
+}
+
+// Totals returns the rain totals at t for a bucket of the given size in mm.
+func (r *Rain) Totals(t time.Time, bucket float64) Totals {
+	r.expire(t)
+	return Totals{
+		Day:        float64(r.DayTotal) * bucket,
+		Hour:       float64(r.Since(t, time.Hour)) * bucket,
+		Day24:      float64(r.Since(t, rainHistory)) * bucket,
+		Storm:      float64(r.StormTotal) * bucket,
+		StormStart: r.StormStart,
+	}
+}
@@ -0,0 +1,58 @@
+package weather
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRainRollover(t *testing.T) {
+	start := time.Date(2019, 3, 24, 22, 0, 0, 0, time.Local)
+	r := NewRain()
+	if tips := r.Update(start, 120); tips != 0 {
+		t.Errorf("first counter counted %d tips", tips)
+	}
+	if tips := r.Update(start.Add(time.Minute), 125); tips != 5 {
+		t.Errorf("got %d tips, want 5", tips)
+	}
+	// packets missed and the counter rolled over
+	if tips := r.Update(start.Add(10*time.Minute), 3); tips != 6 {
+		t.Errorf("rollover: got %d tips, want 6", tips)
+	}
+	if tips := r.Update(start.Add(11*time.Minute), 3); tips != 0 {
+		t.Errorf("unchanged counter: got %d tips", tips)
+	}
+}
+
+func TestRainTotals(t *testing.T) {
+	start := time.Date(2019, 3, 24, 22, 30, 0, 0, time.Local)
+	r := NewRain()
+	r.Update(start, 0)
+	r.Update(start.Add(10*time.Minute), 10)  // 22:40
+	r.Update(start.Add(80*time.Minute), 15)  // 23:50
+	r.Update(start.Add(100*time.Minute), 17) // 00:10 next day
+
+	tot := r.Totals(start.Add(100*time.Minute), Bucket02mm)
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"day", tot.Day, 2 * Bucket02mm},
+		{"hour", tot.Hour, 7 * Bucket02mm},
+		{"24h", tot.Day24, 17 * Bucket02mm},
+		{"storm", tot.Storm, 17 * Bucket02mm},
+	} {
+		if math.Abs(c.got-c.want) > 1e-9 {
+			t.Errorf("%s: got %.2f mm, want %.2f mm", c.name, c.got, c.want)
+		}
+	}
+	if !tot.StormStart.Equal(start.Add(10 * time.Minute)) {
+		t.Errorf("storm start %s", tot.StormStart)
+	}
+
+	// a dry day ends the storm and empties the 24 hour total
+	tot = r.Totals(start.Add(50*time.Hour), Bucket001In)
+	if tot.Storm != 0 || tot.Day24 != 0 || tot.Day != 0 || !tot.StormStart.IsZero() {
+		t.Errorf("after a dry day: %+v", tot)
+	}
+}
@@ -0,0 +1,212 @@
+package weather
+
+import (
+	"math"
+	"time"
+)
+
+// sample is the last value of a sensor and when it was received.
+type sample struct {
+	v float64
+	t time.Time
+}
+
+// Station combines the readings of the transmitters of a station into its
+// current conditions.
+type Station struct {
+	Bucket        float64       // rain per bucket tip in mm
+	Lat, Lon, Alt float64       // location for ET, degrees and m
+	MaxAge        time.Duration // older values are no longer current
+	Rain          [8]Rain       // rain accumulation per transmitter id
+	Stats         Stats         // wind averages, daily highs and lows
+
+	values    [KindRain + 1]sample
+	probes    map[string]sample // leaf & soil probes by name
+	windSpeed sample
+	windDir   sample
+}
+
+// NewStation returns a station without readings.
+func NewStation(bucket float64) *Station {
+	s := &Station{Bucket: bucket, MaxAge: 15 * time.Minute, probes: make(map[string]sample)}
+	for id := range s.Rain {
+		s.Rain[id] = NewRain()
+	}
+	return s
+}
+
+// Update processes a reading and returns the number of new bucket tips.
+func (s *Station) Update(r Reading) (tips int) {
+	s.Stats.Update(r)
+	for _, p := range r.Probes {
+		s.probes[p.Name()] = sample{p.Value, r.Time}
+	}
+	if !r.NoWind {
+		s.windSpeed = sample{r.WindSpeed, r.Time}
+		if r.WindDirValid {
+			s.windDir = sample{r.WindDir, r.Time}
+		}
+	}
+	if !r.Valid || r.Kind == KindNone {
+		return 0
+	}
+	if r.Kind == KindRain {
+		return s.Rain[r.ID].Update(r.Time, int(r.Value))
+	}
+	s.values[r.Kind] = sample{r.Value, r.Time}
+	return 0
+}
+
+// get returns the value of a sample, NaN when it is not current at t.
+func (s *Station) get(smp sample, t time.Time) float64 {
+	if smp.t.IsZero() || t.Sub(smp.t) > s.MaxAge {
+		return math.NaN()
+	}
+	return smp.v
+}
+
+// Conditions are the current conditions of a station in metric units:
+// °C, %, m/s, degrees, mm, mm/h, W/m² and V. Unknown values are NaN.
+type Conditions struct {
+	Time          time.Time
+	OutTemp       float64
+	OutHumidity   float64
+	WindSpeed     float64
+	WindDir       float64
+	WindGust      float64
+	RainRate      float64
+	Rain          Totals
+	Radiation     float64
+	UV            float64
+	SupercapVolt  float64
+	SolarCellVolt float64
+	Probes        map[string]float64 // leaf & soil probes by name, see Probe
+
+	// averages and extremes, see Stats
+	WindSpeed2  float64
+	WindDir2    float64
+	WindSpeed10 float64
+	WindDir10   float64
+	WindGust5   float64
+	WindGust10  float64
+	Day         DayStats
+
+	// derived
+	DewPoint  float64
+	HeatIndex float64
+	WindChill float64
+	AppTemp   float64
+	THSW      float64
+	ET        float64 // mm/h
+}
+
+// Conditions returns the current conditions at t.
+func (s *Station) Conditions(t time.Time) (c Conditions) {
+	c.Time = t
+	c.OutTemp = s.get(s.values[KindTemperature], t)
+	c.OutHumidity = s.get(s.values[KindHumidity], t)
+	c.WindSpeed = s.get(s.windSpeed, t)
+	c.WindDir = s.get(s.windDir, t)
+	c.WindGust = s.get(s.values[KindGust], t)
+	c.RainRate = s.get(s.values[KindRainRate], t)
+	c.Radiation = s.get(s.values[KindSolar], t)
+	c.UV = s.get(s.values[KindUV], t)
+	c.SupercapVolt = s.get(s.values[KindSupercap], t)
+	c.SolarCellVolt = s.get(s.values[KindSolarCell], t)
+	c.Probes = make(map[string]float64)
+	for name, smp := range s.probes {
+		if v := s.get(smp, t); !math.IsNaN(v) {
+			c.Probes[name] = v
+		}
+	}
+	s.Stats.expire(t)
+	c.WindSpeed2, c.WindDir2 = s.Stats.WindAverage(t, 2*time.Minute)
+	c.WindSpeed10, c.WindDir10 = s.Stats.WindAverage(t, 10*time.Minute)
+	c.WindGust5 = s.Stats.Gust(t, 5*time.Minute)
+	c.WindGust10 = s.Stats.Gust(t, 10*time.Minute)
+	c.Day = s.Stats.Day
+	c.Rain = Totals{math.NaN(), math.NaN(), math.NaN(), math.NaN(), time.Time{}}
+	for id := range s.Rain {
+		if s.Rain[id].Counter < 0 {
+			continue
+		}
+		tot := s.Rain[id].Totals(t, s.Bucket)
+		if math.IsNaN(c.Rain.Day) {
+			c.Rain = tot
+			continue
+		}
+		c.Rain.Day += tot.Day
+		c.Rain.Hour += tot.Hour
+		c.Rain.Day24 += tot.Day24
+		c.Rain.Storm += tot.Storm
+		if !tot.StormStart.IsZero() && (c.Rain.StormStart.IsZero() || tot.StormStart.Before(c.Rain.StormStart)) {
+			c.Rain.StormStart = tot.StormStart
+		}
+	}
+
+	// NaN propagates through the formulas, so a missing input leaves the
+	// derived value unknown
+	c.DewPoint = DewPoint(c.OutTemp, c.OutHumidity)
+	c.HeatIndex = HeatIndex(c.OutTemp, c.OutHumidity)
+	c.WindChill = WindChill(c.OutTemp, c.WindSpeed)
+	c.AppTemp = ApparentTemperature(c.OutTemp, c.OutHumidity, c.WindSpeed)
+	c.THSW = THSW(c.OutTemp, c.OutHumidity, c.WindSpeed, c.Radiation)
+	c.ET = ET(c.OutTemp, c.OutHumidity, c.WindSpeed, c.Radiation, t, s.Lat, s.Lon, s.Alt)
+	return c
+}
+
+// Values returns the known values by their weewx names. The daily highs
+// and lows are named like the weewx daily summaries, e.g. outTemp_max and
+// outTemp_maxtime, with the times in Unix seconds.
+func (c Conditions) Values() map[string]float64 {
+	values := make(map[string]float64)
+	extreme := func(name string, e Extreme) {
+		if !e.Time.IsZero() {
+			values[name] = e.Value
+			values[name+"time"] = float64(e.Time.Unix())
+		}
+	}
+	for name, v := range c.Probes {
+		values[name] = v
+	}
+	extreme("outTemp_max", c.Day.OutTemp.High)
+	extreme("outTemp_min", c.Day.OutTemp.Low)
+	extreme("outHumidity_max", c.Day.OutHumidity.High)
+	extreme("outHumidity_min", c.Day.OutHumidity.Low)
+	extreme("windSpeed_max", c.Day.WindSpeed.High)
+	extreme("windGust_max", c.Day.WindGust.High)
+	extreme("rainRate_max", c.Day.RainRate.High)
+	for name, v := range map[string]float64{
+		"outTemp":       c.OutTemp,
+		"outHumidity":   c.OutHumidity,
+		"windSpeed":     c.WindSpeed,
+		"windDir":       c.WindDir,
+		"windGust":      c.WindGust,
+		"windSpeed2":    c.WindSpeed2,
+		"windDir2":      c.WindDir2,
+		"windSpeed10":   c.WindSpeed10,
+		"windDir10":     c.WindDir10,
+		"windGust5":     c.WindGust5,
+		"windGust10":    c.WindGust10,
+		"rainRate":      c.RainRate,
+		"dayRain":       c.Rain.Day,
+		"hourRain":      c.Rain.Hour,
+		"rain24":        c.Rain.Day24,
+		"stormRain":     c.Rain.Storm,
+		"radiation":     c.Radiation,
+		"UV":            c.UV,
+		"supercapVolt":  c.SupercapVolt,
+		"solarCellVolt": c.SolarCellVolt,
+		"dewpoint":      c.DewPoint,
+		"heatindex":     c.HeatIndex,
+		"windchill":     c.WindChill,
+		"appTemp":       c.AppTemp,
+		"THSW":          c.THSW,
+		"ET":            c.ET,
+	} {
+		if !math.IsNaN(v) {
+			values[name] = v
+		}
+	}
+	return values
+}
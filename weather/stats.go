@@ -0,0 +1,164 @@
+package weather
+
+import (
+	"math"
+	"time"
+)
+
+// windHistory is how long wind samples are kept for the averages.
+const windHistory = 10 * time.Minute
+
+type windSample struct {
+	t        time.Time
+	speed    float64
+	dir      float64
+	dirValid bool
+}
+
+// Extreme is a high or low and when it occurred; Time is zero when there is
+// none yet.
+type Extreme struct {
+	Value float64
+	Time  time.Time
+}
+
+// HighLow tracks the high and low of a value.
+type HighLow struct {
+	High, Low Extreme
+}
+
+func (h *HighLow) update(v float64, t time.Time) {
+	if math.IsNaN(v) {
+		return
+	}
+	if h.High.Time.IsZero() || v > h.High.Value {
+		h.High = Extreme{v, t}
+	}
+	if h.Low.Time.IsZero() || v < h.Low.Value {
+		h.Low = Extreme{v, t}
+	}
+}
+
+// DayStats are the highs and lows of a day. Its exported fields are the
+// state to save across restarts.
+type DayStats struct {
+	Start       time.Time // start of the day the stats belong to
+	OutTemp     HighLow
+	OutHumidity HighLow
+	WindSpeed   HighLow
+	WindGust    HighLow
+	RainRate    HighLow
+}
+
+// Stats keeps the rolling wind averages and the daily highs and lows the
+// way a Davis console does.
+type Stats struct {
+	// DayStart is the time after local midnight the day starts, and the
+	// daily highs and lows are reset.
+	DayStart time.Duration
+	Day      DayStats
+
+	wind  []windSample
+	gusts []windSample // gust readings, only speed is used
+}
+
+// dayStart returns the start of the day t belongs to.
+func (s *Stats) dayStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, t.Location()).Add(s.DayStart)
+	if t.Before(start) {
+		start = time.Date(y, m, d-1, 0, 0, 0, 0, t.Location()).Add(s.DayStart)
+	}
+	return start
+}
+
+// expire drops what is no longer part of the statistics at t.
+func (s *Stats) expire(t time.Time) {
+	if start := s.dayStart(t); !start.Equal(s.Day.Start) {
+		s.Day = DayStats{Start: start}
+	}
+	s.wind = expireWind(s.wind, t)
+	s.gusts = expireWind(s.gusts, t)
+}
+
+func expireWind(samples []windSample, t time.Time) []windSample {
+	n := 0
+	for n < len(samples) && t.Sub(samples[n].t) >= windHistory {
+		n++
+	}
+	return samples[n:]
+}
+
+// Update processes a reading.
+func (s *Stats) Update(r Reading) {
+	s.expire(r.Time)
+	if !r.NoWind {
+		s.wind = append(s.wind, windSample{r.Time, r.WindSpeed, r.WindDir, r.WindDirValid})
+		s.Day.WindSpeed.update(r.WindSpeed, r.Time)
+	}
+	if !r.Valid {
+		return
+	}
+	switch r.Kind {
+	case KindTemperature:
+		s.Day.OutTemp.update(r.Value, r.Time)
+	case KindHumidity:
+		s.Day.OutHumidity.update(r.Value, r.Time)
+	case KindGust:
+		s.gusts = append(s.gusts, windSample{t: r.Time, speed: r.Value})
+		s.Day.WindGust.update(r.Value, r.Time)
+	case KindRainRate:
+		s.Day.RainRate.update(r.Value, r.Time)
+	}
+}
+
+// WindAverage returns the average wind speed and direction over the last d
+// up to t. The speed is the scalar mean, the direction the mean of the wind
+// vectors, so north-westerly and north-easterly winds average to north and
+// calm samples do not count. Without samples both are NaN; the direction
+// is NaN as well when all samples are calm.
+func (s *Stats) WindAverage(t time.Time, d time.Duration) (speed, dir float64) {
+	var sum, x, y float64
+	n := 0
+	for _, w := range s.wind {
+		if age := t.Sub(w.t); age >= d || age < 0 {
+			continue
+		}
+		sum += w.speed
+		n++
+		if w.dirValid {
+			rad := w.dir * math.Pi / 180
+			x += w.speed * math.Sin(rad)
+			y += w.speed * math.Cos(rad)
+		}
+	}
+	if n == 0 {
+		return math.NaN(), math.NaN()
+	}
+	speed = sum / float64(n)
+	if x == 0 && y == 0 {
+		return speed, math.NaN()
+	}
+	dir = math.Atan2(x, y) * 180 / math.Pi
+	if dir < 0 {
+		dir += 360
+	}
+	return speed, dir
+}
+
+// Gust returns the highest wind speed or gust reading over the last d up to
+// t, NaN without samples.
+func (s *Stats) Gust(t time.Time, d time.Duration) float64 {
+	gust := math.NaN()
+	for _, samples := range [][]windSample{s.wind, s.gusts} {
+		for _, w := range samples {
+			if age := t.Sub(w.t); age >= d || age < 0 {
+				continue
+			}
+			if math.IsNaN(gust) || w.speed > gust {
+				gust = w.speed
+			}
+		}
+	}
+	return gust
+}
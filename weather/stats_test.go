@@ -0,0 +1,90 @@
+package weather
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWindAverage(t *testing.T) {
+	start := time.Date(2019, 3, 24, 12, 0, 0, 0, time.UTC)
+	var s Stats
+	for i, w := range []struct{ speed, dir float64 }{
+		{2, 315}, // 12:00
+		{4, 45},  // 12:04
+		{0, 180}, // 12:08, calm
+		{4, 45},  // 12:09
+	} {
+		s.Update(Reading{Time: start.Add([]time.Duration{0, 4, 8, 9}[i] * time.Minute),
+			WindSpeed: w.speed, WindDir: w.dir, WindDirValid: true})
+	}
+
+	at := start.Add(9*time.Minute + 30*time.Second)
+	speed, dir := s.WindAverage(at, 10*time.Minute)
+	if speed != 2.5 {
+		t.Errorf("10 min speed: got %.2f, want 2.5", speed)
+	}
+	// 2 m/s from 315° and 8 m/s from 45°
+	if want := 45 - math.Atan(2.0/8)*180/math.Pi; math.Abs(dir-want) > 1e-9 {
+		t.Errorf("10 min direction: got %.2f, want %.2f", dir, want)
+	}
+	speed, dir = s.WindAverage(at, 2*time.Minute)
+	if speed != 2 || math.Abs(dir-45) > 1e-9 {
+		t.Errorf("2 min: got %.2f m/s %.2f°, want 2 m/s 45°", speed, dir)
+	}
+
+	// across north
+	s = Stats{}
+	s.Update(Reading{Time: start, WindSpeed: 3, WindDir: 350, WindDirValid: true})
+	s.Update(Reading{Time: start, WindSpeed: 3, WindDir: 10, WindDirValid: true})
+	if _, dir := s.WindAverage(start, time.Minute); math.Abs(dir) > 1e-9 && math.Abs(dir-360) > 1e-9 {
+		t.Errorf("across north: got %.2f°, want 0°", dir)
+	}
+
+	if speed, dir := s.WindAverage(start.Add(time.Hour), time.Minute); !math.IsNaN(speed) || !math.IsNaN(dir) {
+		t.Errorf("without samples: got %.2f m/s %.2f°", speed, dir)
+	}
+}
+
+func TestGust(t *testing.T) {
+	start := time.Date(2019, 3, 24, 12, 0, 0, 0, time.UTC)
+	var s Stats
+	s.Update(Reading{Time: start, WindSpeed: 9})
+	s.Update(Reading{Time: start.Add(5 * time.Minute), WindSpeed: 3, Kind: KindGust, Value: 7, Valid: true})
+	s.Update(Reading{Time: start.Add(6 * time.Minute), WindSpeed: 4})
+
+	if g := s.Gust(start.Add(9*time.Minute), 10*time.Minute); g != 9 {
+		t.Errorf("got %.1f, want 9", g)
+	}
+	if g := s.Gust(start.Add(11*time.Minute), 10*time.Minute); g != 7 {
+		t.Errorf("after the 9 m/s expired: got %.1f, want 7", g)
+	}
+}
+
+func TestDayStats(t *testing.T) {
+	loc := time.FixedZone("CET", 3600)
+	var s Stats
+	s.DayStart = 9 * time.Hour
+	temp := func(at time.Time, v float64) {
+		s.Update(Reading{Time: at, Kind: KindTemperature, Value: v, Valid: true})
+	}
+
+	morning := time.Date(2019, 3, 24, 7, 0, 0, 0, loc)
+	temp(morning, 4)
+	temp(morning.Add(time.Hour), 2)
+	if s.Day.Start != time.Date(2019, 3, 23, 9, 0, 0, 0, loc) {
+		t.Errorf("day started %s", s.Day.Start)
+	}
+	if s.Day.OutTemp.Low.Value != 2 || s.Day.OutTemp.High.Value != 4 || !s.Day.OutTemp.High.Time.Equal(morning) {
+		t.Errorf("before 9:00: got %+v", s.Day.OutTemp)
+	}
+
+	// the day is reset at 9:00
+	temp(morning.Add(3*time.Hour), 10)
+	if s.Day.Start != time.Date(2019, 3, 24, 9, 0, 0, 0, loc) {
+		t.Errorf("day started %s", s.Day.Start)
+	}
+	if s.Day.OutTemp.Low.Value != 10 || s.Day.OutTemp.High.Value != 10 {
+		t.Errorf("after 9:00: got %+v", s.Day.OutTemp)
+	}
+}